@@ -0,0 +1,83 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/deckarep/tips/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(cpCmd)
+}
+
+var cpCmd = &cobra.Command{
+	Use:   "cp [primary-filter] [local-path] [remote-dir]",
+	Short: "Copies a local file or directory to all matching hosts",
+	Long: `Copies a local file or directory into the remote directory of all matching hosts in parallel. The same
+primary filter, --filter, --slice and --concurrency flags apply as they do for remote commands. Use @ to match all
+hosts. A relative remote directory is relative to the remote user's home directory.`,
+	Example: "  tips cp blade ./nginx.conf /tmp/conf\n  tips cp @ ./scripts scripts --filter 'tag:web'",
+	Args:    cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgCtx, err := packageCfg(args[:1])
+		if err != nil {
+			return err
+		}
+
+		localPath, remoteDir := args[1], args[2]
+
+		// Fail fast, rather than once per host.
+		if _, err = os.Stat(localPath); err != nil {
+			return err
+		}
+
+		ctx := newCfgContext(cfgCtx)
+
+		view, err := getDevicesView(ctx)
+		if err != nil {
+			return err
+		}
+
+		executor, err := pkg.NewRemoteExecutor(ctx)
+		if err != nil {
+			return err
+		}
+
+		hosts := getHosts(ctx, view)
+		desc := fmt.Sprintf("copy of %s to %s", localPath, remoteDir)
+		if detached, err := beforeRun(ctx, hosts, desc); detached || err != nil {
+			return err
+		}
+
+		results := pkg.ExecuteClusterCopy(ctx, os.Stdout, executor, hosts, localPath, remoteDir)
+		return checkResults(cmd, "copy", results)
+	},
+}
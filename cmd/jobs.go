@@ -0,0 +1,173 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/deckarep/tips/pkg"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	jobsCmd.AddCommand(jobsListCmd, jobsShowCmd, jobsLogsCmd, jobsRmCmd)
+	rootCmd.AddCommand(jobsCmd)
+
+	cobra.OnInitialize(func() {
+		if isDetachedRunner() {
+			pkg.CaptureRunnerLog()
+		}
+	})
+}
+
+func isDetachedRunner() bool {
+	return len(viper.GetString("job_id")) > 0
+}
+
+// recordRunnerExit records how a detached runner ended into its job, as nobody is around to read its output. That
+// way `tips jobs show` tells why a run failed or never even started.
+func recordRunnerExit(runErr error) {
+	if !isDetachedRunner() {
+		return
+	}
+
+	jobID := viper.GetString("job_id")
+	if err := pkg.NewJobStore(viper.GetString("tailnet")).RecordRunnerExit(context.Background(), jobID, runErr); err != nil {
+		log.Error("error recording the exit of the runner", "job", jobID, "error", err)
+	}
+}
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Checks on remote runs started with --detach",
+	Long: `A remote command, script, http request, cp or pull started with --detach runs in the background as a job. The
+job records the status and output of every host into the local db as it goes, so it can be checked on from any
+terminal, even after reconnecting. The --json flag applies to all of the jobs commands. Jobs which are over are
+removed after --job_retention, or right away with tips jobs rm.`,
+	Example: "  tips blade 'sudo apt-get upgrade -y' --detach\n  tips jobs list\n  tips jobs show <id>\n  tips jobs logs <id>\n  tips jobs rm <id>",
+}
+
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all jobs, the most recently started first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgCtx, err := packageCfg(nil)
+		if err != nil {
+			return err
+		}
+
+		ctx := newCfgContext(cfgCtx)
+
+		jobs, err := pkg.NewJobStore(cfgCtx.Tailnet).List(ctx)
+		if err != nil {
+			return err
+		}
+		return pkg.RenderJobs(ctx, os.Stdout, jobs)
+	},
+}
+
+var jobsShowCmd = &cobra.Command{
+	Use:   "show [job-id]",
+	Short: "Shows the state of a job along with the status of each of its hosts",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgCtx, err := packageCfg(nil)
+		if err != nil {
+			return err
+		}
+
+		ctx := newCfgContext(cfgCtx)
+
+		job, err := pkg.NewJobStore(cfgCtx.Tailnet).Get(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return pkg.RenderJob(ctx, os.Stdout, job)
+	},
+}
+
+var jobsLogsCmd = &cobra.Command{
+	Use:   "logs [job-id]",
+	Short: "Prints the output of a job recorded so far, stderr is only included with --stderr",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgCtx, err := packageCfg(nil)
+		if err != nil {
+			return err
+		}
+
+		ctx := newCfgContext(cfgCtx)
+		store := pkg.NewJobStore(cfgCtx.Tailnet)
+
+		// Fails on an unknown job, rather than printing nothing.
+		if _, err = store.Get(ctx, args[0]); err != nil {
+			return err
+		}
+
+		lines, err := store.Logs(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return pkg.RenderJobLogs(ctx, os.Stdout, lines)
+	},
+}
+
+var jobsRmCmd = &cobra.Command{
+	Use:   "rm [job-id...]",
+	Short: "Removes one or more jobs along with their output, a job which is still running can't be removed",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgCtx, err := packageCfg(nil)
+		if err != nil {
+			return err
+		}
+
+		ctx := newCfgContext(cfgCtx)
+		store := pkg.NewJobStore(cfgCtx.Tailnet)
+
+		// Nothing is removed unless all of them can be.
+		for _, id := range args {
+			job, err := store.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			if !job.Over() {
+				return fmt.Errorf("the job %s is still %s", job.ID, job.State)
+			}
+		}
+
+		if err = store.Remove(ctx, args...); err != nil {
+			return err
+		}
+		return pkg.RenderJobsRemoved(ctx, os.Stdout, args)
+	},
+}
@@ -0,0 +1,72 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/deckarep/tips/pkg"
+	"github.com/deckarep/tips/pkg/tailscale_cli"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(pingCmd)
+}
+
+var pingCmd = &cobra.Command{
+	Use:   "ping [primary-filter]",
+	Short: "Pings all matching hosts over the tailnet",
+	Long: `Pings all matching hosts over the tailnet with tailscale ping, many at once, and adds whether each host is
+reachable, its round-trip latency and the path taken to the usual table: direct, or relayed via DERP along with the
+relay region. The same primary filter, --filter, --slice, --sort and --concurrency flags apply, the ping columns may
+be sorted on too. Each ping gives up after --cli_timeout. Use @ to match all hosts.`,
+	Example: "  tips ping blade\n  tips ping @ --filter 'tag:web' --sort 'reachable:asc,latency:dsc'",
+	Args:    cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgCtx, err := packageCfg(args)
+		if err != nil {
+			return err
+		}
+
+		ctx := newCfgContext(cfgCtx)
+
+		view, err := getDevicesView(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err = pkg.PingDevicesTable(ctx, view, tailscale_cli.Ping); err != nil {
+			return err
+		}
+
+		if cfgCtx.JsonOutput {
+			return pkg.RenderJson(ctx, view, os.Stdout)
+		}
+		return renderTable(ctx, view)
+	},
+}
@@ -0,0 +1,88 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/deckarep/tips/pkg"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	ports        string
+	probeTimeout time.Duration
+)
+
+func init() {
+	probeCmd.Flags().StringVar(&ports, "ports", "", "comma separated tcp ports to probe on every host: --ports 22,443,9100")
+	viper.BindPFlag("ports", probeCmd.Flags().Lookup("ports"))
+	probeCmd.Flags().DurationVar(&probeTimeout, "probe_timeout", pkg.DefaultProbeTimeout,
+		"how long a single connection attempt may take before the port is considered filtered")
+	viper.BindPFlag("probe_timeout", probeCmd.Flags().Lookup("probe_timeout"))
+
+	rootCmd.AddCommand(probeCmd)
+}
+
+var probeCmd = &cobra.Command{
+	Use:   "probe [primary-filter] --ports [ports]",
+	Short: "Probes tcp ports on all matching hosts",
+	Long: `Probes a list of tcp ports on all matching hosts, straight from this machine over the tailnet, and adds a
+column per port to the usual table: open when the connection was accepted, closed when it was refused and filtered
+when nothing answered within --probe_timeout. Handy to verify that a firewall or ACL change took effect. The same
+primary filter, --filter, --slice, --sort, --concurrency and --json flags apply. Use @ to match all hosts.`,
+	Example: "  tips probe blade --ports 22,443\n  tips probe @ --filter 'tag:web' --ports 22,443,9100 --json",
+	Args:    cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgCtx, err := packageCfg(args)
+		if err != nil {
+			return err
+		}
+
+		if len(cfgCtx.Ports) == 0 {
+			return errors.New("the --ports flag is required: --ports 22,443,9100")
+		}
+
+		ctx := newCfgContext(cfgCtx)
+
+		view, err := getDevicesView(ctx)
+		if err != nil {
+			return err
+		}
+
+		pkg.ProbeDevicesTable(ctx, view, cfgCtx.Ports, cfgCtx.ProbeTimeout, (&net.Dialer{}).DialContext)
+
+		if cfgCtx.JsonOutput {
+			return pkg.RenderJson(ctx, view, os.Stdout)
+		}
+		return renderTable(ctx, view)
+	},
+}
@@ -0,0 +1,75 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/deckarep/tips/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(pullCmd)
+}
+
+var pullCmd = &cobra.Command{
+	Use:   "pull [primary-filter] [remote-path] [local-dir]",
+	Short: "Fetches a remote file or directory from all matching hosts",
+	Long: `Fetches a remote file or directory, such as a log file or a core dump, from all matching hosts in parallel.
+Each copy lands in a local directory keyed by the machine name: <local-dir>/<machine>/<name>. The same primary
+filter, --filter, --slice and --concurrency flags apply as they do for remote commands. Use @ to match all hosts.`,
+	Example: "  tips pull blade /var/log/app.log ./out\n  tips pull @ /var/crash ./incident-42 --filter 'tag:web'",
+	Args:    cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfgCtx, err := packageCfg(args[:1])
+		if err != nil {
+			return err
+		}
+
+		ctx := newCfgContext(cfgCtx)
+
+		view, err := getDevicesView(ctx)
+		if err != nil {
+			return err
+		}
+
+		executor, err := pkg.NewRemoteExecutor(ctx)
+		if err != nil {
+			return err
+		}
+
+		hosts := getHosts(ctx, view)
+		if detached, err := beforeRun(ctx, hosts, fmt.Sprintf("pull of %s to %s", args[1], args[2])); detached || err != nil {
+			return err
+		}
+
+		results := pkg.ExecuteClusterPull(ctx, os.Stdout, executor, hosts, args[1], args[2])
+		return checkResults(cmd, "pull", results)
+	},
+}
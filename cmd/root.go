@@ -26,9 +26,10 @@ SOFTWARE.
 package cmd
 
 import (
-	"context"
-	"fmt"
+	"errors"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/deckarep/tips/pkg"
@@ -36,32 +37,58 @@ import (
 
 	"github.com/charmbracelet/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
 	//cfgFile       string
 	basic         bool
+	batch         string
+	batchPause    time.Duration
+	canary        int
 	cacheTimeout  time.Duration
 	clientTimeout time.Duration
+	cmdTimeout    time.Duration
 	cliTimeout    time.Duration
+	collapse      bool
+	collapseExit  bool
 	columns       string
 	concurrency   int
+	dashboard     bool
+	deadline      time.Duration
+	detach        bool
+	dryRun        bool
+	executorName  string
 	filter        string
+	grouped       bool
+	groupOrder    string
+	httpBody      bool
+	httpMethod    string
+	httpTarget    string
 	nocache       bool
 	nocolor       bool
+	script        string
 	slice         string
 	sortOrder     string
 	stderr        bool
 	tailnet       string
+	templateCmd   bool
 	tipsAPIKey    string
 	useCSSHX      bool
 	useOauth      bool
 	useSSH        bool
 	test          bool
+	useTmux       bool
+	tmuxPanes     int
 	ips           bool
 	ips_delimiter string
+	jobID         string
+	jobRetention  time.Duration
 	jsonn         bool
+	maxFailures   int
+	outputDir     string
 	page          int
+	yes           bool
 )
 
 // bindRootBoolFlag binds a boolean cobra flag to a viper config flag.
@@ -90,30 +117,86 @@ func bindRootDurationFlag(pDuration *time.Duration, name, shorthand string, valu
 
 func init() {
 	bindRootBoolFlag(&basic, "basic", "when true, renders the table as simple ascii with no color", false)
+	bindRootStringFlag(&batch, "batch", "", "",
+		"rolls a remote command out in batches of n hosts or a percentage of hosts: --batch 5 or --batch 10%")
+	bindRootDurationFlag(&batchPause, "batch_pause", "", 0, "how long to pause in-between batches of a rolling remote command")
+	bindRootIntFlag(&canary, "canary", "", 0,
+		"runs a remote command on the first n hosts by themselves, halting the rollout if any of them fail")
 	bindRootDurationFlag(&cacheTimeout, "cache_timeout", "", time.Minute*5, "timeout duration for local db (db.bolt) cache file")
 	bindRootDurationFlag(&clientTimeout, "client_timeout", "", time.Second*5, "timeout duration for the Tailscale api")
+	bindRootDurationFlag(&cmdTimeout, "cmd_timeout", "", 0,
+		"per host timeout of a remote command, hosts exceeding it are killed and reported as timed out")
+	bindRootBoolFlag(&collapse, "collapse",
+		"prints each distinct output of a remote command once, beneath the compacted list of hosts which produced it", false)
+	bindRootBoolFlag(&collapseExit, "collapse_exit_code",
+		"with --collapse, hosts must also share the same exit code to be collapsed together", false)
 	bindRootStringFlag(&columns, "columns", "", "", "columns limits which columns to return")
 	bindRootIntFlag(&concurrency, "concurrency", "c", 5, "concurrency level when executing requests")
+	bindRootBoolFlag(&dashboard, "dashboard",
+		"shows a live dashboard of every host's state and last line of output while a remote command runs", false)
+	bindRootDurationFlag(&deadline, "deadline", "", 0,
+		"timeout for an entire remote run, running hosts are killed and hosts not yet started are skipped")
+	bindRootBoolFlag(&detach, "detach",
+		"starts a remote command, script, http request, cp or pull in the background as a job, see: tips jobs", false)
+	bindRootBoolFlag(&dryRun, "dry_run",
+		"prints the hosts a remote command, script, cp or pull would run on and exactly how, without running anything", false)
+	bindRootStringFlag(&executorName, "executor", "e", pkg.ExecutorAuto,
+		"backend used to reach remote hosts: auto, ssh, tailscale (tailscale ssh) or native (built-in ssh client)")
 	bindRootStringFlag(&filter, "filter", "f", "", "if provided, applies filtering logic: --filter 'tag:tunnel'")
+	bindRootBoolFlag(&grouped, "grouped",
+		"buffers the output of each host and prints it as one block once the host completes", false)
+	bindRootStringFlag(&groupOrder, "group_order", "", pkg.GroupOrderCompletion,
+		"the order --grouped output blocks are printed in: completion or index")
+	bindRootStringFlag(&httpMethod, "http", "", "",
+		"makes an http request with this method to every matching host from this machine: --http GET :8080/healthz")
+	bindRootBoolFlag(&httpBody, "http_body", "with --http, prints the full response body instead of an excerpt", false)
+	bindRootStringFlag(&httpTarget, "http_target", "", pkg.HTTPTargetIPv4,
+		"with --http, how hosts are addressed: ipv4 (Tailscale address) or dns (MagicDNS name)")
 	bindRootBoolFlag(&ips, "ips", "when provided returns ips comma-delimited", false)
 	bindRootStringFlag(&ips_delimiter, "delimiter", "d", "\n", "delimiter to use when the --ips flag is provided")
-	bindRootBoolFlag(&jsonn, "json", "when true returns only json data", false)
+	// The job a detached runner records into, it's only ever passed by --detach itself.
+	bindRootStringFlag(&jobID, "job_id", "", "", "the id of the job to record a detached run into")
+	rootCmd.PersistentFlags().MarkHidden("job_id")
+	bindRootDurationFlag(&jobRetention, "job_retention", "", time.Hour*24*7,
+		"how long jobs started with --detach are kept once they're over, 0 keeps them forever")
+	bindRootBoolFlag(&jsonn, "json",
+		"when true returns only json data, for a remote command that is one ndjson event per line of output, host and run", false)
+	bindRootIntFlag(&maxFailures, "max_failures", "", 0,
+		"stops starting new hosts once this many hosts have failed a remote command, 0 means unlimited")
 	bindRootBoolFlag(&nocache, "nocache", "forces the cache to be expunged", false)
 	bindRootBoolFlag(&nocolor, "nocolor", "when --nocolor is provided disables log color highlighting", false)
+	bindRootStringFlag(&outputDir, "output_dir", "", "",
+		"records a remote run into this directory as a log file per host along with a run.jsonl manifest")
 	bindRootIntFlag(&page, "page", "p", 1, "use with slicing to get the next page of results, paging is 1-based")
+	bindRootStringFlag(&script, "script", "", "",
+		"uploads and runs a local script on all matching hosts, arguments for it follow --: --script ./fix.sh -- arg1 arg2")
 	bindRootStringFlag(&slice, "slice", "", "", "slices the results after filtering followed by sorting")
 	bindRootStringFlag(&sortOrder, "sort", "s", "",
 		"overrides the default/configured sort order --sort 'machine,address:dsc' the default order is always ascending (asc) for each column")
 	bindRootBoolFlag(&stderr, "stderr",
 		"for remotely execute commands asks tips to include stderr output", false)
 	bindRootStringFlag(&tailnet, "tailnet", "t", "", "the tailnet to operate on (required)")
+	bindRootBoolFlag(&templateCmd, "template",
+		"evaluates the remote command as a Go template for every host: --template 'curl http://{{.IPv4}}:9100'", false)
 	bindRootBoolFlag(&test, "test", "when true runs the tool in test mode with mocked data", false)
 	bindRootStringFlag(&tipsAPIKey, "tips_api_key", "", "", "tailscale api key for remote requests")
-	bindRootBoolFlag(&useCSSHX, "csshx", "if csshx is installed, opens a multi-window session over all matching hosts", false)
-	bindRootBoolFlag(&useSSH, "ssh", "ssh into a matching single host", false)
+	bindRootBoolFlag(&yes, "yes",
+		"skips the confirmation required by the confirm_threshold and protected_tags policies", false)
+	bindRootBoolFlag(&useCSSHX, "csshx",
+		"opens a multi-window session over all matching hosts with csshx, or with tmux when csshx is not installed", false)
+	bindRootBoolFlag(&useSSH, "ssh", "opens an interactive ssh session on the matching host, prompting to pick one when several match", false)
+	bindRootBoolFlag(&useTmux, "tmux",
+		"opens a tmux session with a synchronized pane per matching host, typing goes to all hosts of a window", false)
+	bindRootIntFlag(&tmuxPanes, "tmux_panes", "", pkg.DefaultTmuxPanes,
+		"the most panes per tmux window, larger selections are split over multiple windows")
 	bindRootBoolFlag(&useOauth, "oauth", "use oauth when flag is provided.", false)
 	bindRootDurationFlag(&cliTimeout, "cli_timeout", "", time.Second*5, "timeout duration for the Tailscale cli")
 
+	// Flags are snake_case, but accept the dashed spelling too: --max-failures is the same as --max_failures.
+	rootCmd.SetGlobalNormalizationFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		return pflag.NormalizedName(strings.ReplaceAll(name, "-", "_"))
+	})
+
 	// Required flags are set here.
 	// This doesn't seem compatible with Viper.
 	// rootCmd.MarkPersistentFlagRequired("tailnet")
@@ -127,50 +210,97 @@ var rootCmd = &cobra.Command{
                 Complete documentation is available at: github.com/deckarep/tips`,
 	Args: cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
-
 		// 0. Package all configuration logic.
-		cfgCtx, err := packageCfg(args)
+		cfgArgs, scriptArgs := splitScriptArgs(cmd, args)
+		cfgCtx, err := packageCfg(cfgArgs)
 		if err != nil {
 			return err
 		}
+		cfgCtx.ScriptArgs = scriptArgs
 
-		ctx = context.WithValue(ctx, pkg.CtxKeyConfig, cfgCtx)
-		// CONSIDER: should this show all flags?
-		ctx = context.WithValue(ctx, pkg.CtxKeyUserQuery, fmt.Sprintf("%s %s", cfgCtx.PrefixFilter.Query(), cfgCtx.RemoteCmd))
+		ctx := newCfgContext(cfgCtx)
 
-		client := pkg.NewClient(ctx)
-		if useOauth {
-			client = pkg.NewOauthClient(ctx)
+		view, err := getDevicesView(ctx)
+		if err != nil {
+			return err
 		}
 
-		cachedDevRepo := pkg.NewCachedRepo(pkg.NewRemoteDeviceRepo(client))
-		var devicesResourceFunc = cachedDevRepo.DevicesResource
+		if cfgCtx.SSH {
+			// Interactive ssh into a single host, picking one when more than one matched.
+			host, err := selectHost(ctx, view)
+			if err != nil {
+				return err
+			}
 
-		// In test mode, indirect to mocked test data.
-		// TODO: refactor this out as it doesn't belong here.
-		if cfgCtx.TestMode {
-			mockDevRepo := pkg.NewMockedDeviceRepo()
-			cachedDevRepo = pkg.NewCachedRepo(mockDevRepo)
-			devicesResourceFunc = cachedDevRepo.DevicesResource
-		}
+			executor, err := pkg.NewRemoteExecutor(ctx)
+			if err != nil {
+				return err
+			}
 
-		devList, err := devicesResourceFunc(ctx)
-		if err != nil {
-			return err
-		}
+			if _, err = beforeRun(ctx, []pkg.RemoteCmdHost{host}, "interactive session"); err != nil {
+				return err
+			}
 
-		view, err := pkg.ProcessDevicesTable(ctx, devList)
-		if err != nil {
-			return err
-		}
+			return pkg.StartInteractiveSession(ctx, executor, host)
+		} else if cfgCtx.CSSHX || cfgCtx.Tmux {
+			// A multi-pane session over all matching hosts.
+			hosts := getHosts(ctx, view)
+			if len(hosts) == 0 {
+				return errors.New("no hosts matched the query")
+			}
+
+			// Whatever is typed goes to every host, so it's guarded just like a remote command.
+			if _, err = beforeRun(ctx, hosts, "broadcast session"); err != nil {
+				return err
+			}
+
+			return startBroadcastSession(ctx, hosts)
+		} else if len(cfgCtx.Script) > 0 {
+			// Upload and run a local script on all hosts.
+			script, err := os.ReadFile(cfgCtx.Script)
+			if err != nil {
+				return err
+			}
+
+			executor, err := pkg.NewRemoteExecutor(ctx)
+			if err != nil {
+				return err
+			}
+
+			hosts := getHosts(ctx, view)
+			if detached, err := beforeRun(ctx, hosts, "script: "+cfgCtx.Script); detached || err != nil {
+				return err
+			}
+
+			results := pkg.ExecuteClusterScript(ctx, os.Stdout, executor, hosts, cfgCtx.Script, script,
+				cfgCtx.ScriptArgs)
+
+			if err = checkResults(cmd, "script", results); err != nil {
+				return err
+			}
+		} else if len(cfgCtx.HTTPMethod) > 0 {
+			// Make the http request against all hosts, straight from this machine.
+			spec, err := pkg.ParseHTTPRequest(cfgCtx.HTTPMethod, cfgCtx.RemoteCmd)
+			if err != nil {
+				return err
+			}
 
-		if cfgCtx.IsRemoteCommand() {
-			// It's a remote command, instead of rendering a table execute the remote command over all hosts.
 			hosts := getHosts(ctx, view)
+			if detached, err := beforeRun(ctx, hosts, "http request: "+spec.String()); detached || err != nil {
+				return err
+			}
 
-			// Do the remote cluster command.
-			pkg.ExecuteClusterRemoteCmd(ctx, os.Stdout, hosts, cfgCtx.RemoteCmd)
+			results := pkg.ExecuteClusterHTTP(ctx, os.Stdout, &http.Client{}, hosts, spec, cfgCtx.HTTPTarget,
+				cfgCtx.HTTPBody)
+
+			if err = checkResults(cmd, "http request", results); err != nil {
+				return err
+			}
+		} else if cfgCtx.IsRemoteCommand() {
+			// It's a remote command, instead of rendering a table execute the remote command over all hosts.
+			if err = runRemoteCommand(cmd, ctx, view); err != nil {
+				return err
+			}
 		} else {
 			if cfgCtx.JsonOutput {
 				if err = pkg.RenderJson(ctx, view, os.Stdout); err != nil {
@@ -181,14 +311,8 @@ var rootCmd = &cobra.Command{
 					return err
 				}
 			} else {
-				if cfgCtx.Basic {
-					if err = pkg.RenderASCIITableView(ctx, view, os.Stdout); err != nil {
-						return err
-					}
-				} else {
-					if err = pkg.RenderTableView(ctx, view, os.Stdout); err != nil {
-						return err
-					}
+				if err = renderTable(ctx, view); err != nil {
+					return err
 				}
 			}
 		}
@@ -198,7 +322,10 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	recordRunnerExit(err)
+
+	if err != nil {
 		log.Print("root command failed", "error", err)
 		os.Exit(1)
 	}
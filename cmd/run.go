@@ -0,0 +1,110 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/deckarep/tips/pkg"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run [recipe] [primary-filter]",
+	Short: "Runs a recipe, a remote command saved in the config",
+	Long: `Runs a recipe from the recipes section of the config, which saves a remote command under a name along with
+the filter, concurrency, batch, stderr and template settings it runs with. The primary filter narrows down the hosts the recipe
+runs on, just like --filter narrows down the recipe's filter. Any other setting given as a flag wins over the
+recipe's. Without a recipe, all recipes are listed.`,
+	Example: "  tips run\n  tips run restart-nginx\n  tips run restart-nginx blade --filter 'tag:prod' --dry_run",
+	Args:    cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var recipes map[string]pkg.Recipe
+		if err := viper.UnmarshalKey("recipes", &recipes); err != nil {
+			return fmt.Errorf("invalid recipes in the config file: %w", err)
+		}
+
+		if len(args) == 0 {
+			return pkg.RenderRecipes(context.Background(), os.Stdout, recipes)
+		}
+
+		recipe, err := pkg.LookupRecipe(recipes, args[0])
+		if err != nil {
+			return err
+		}
+		applyRecipe(cmd, recipe)
+
+		// Just like the root command, the recipe runs on all hosts its filter matches unless told otherwise.
+		primaryFilter := "@"
+		if len(args) > 1 {
+			primaryFilter = args[1]
+		}
+
+		cfgCtx, err := packageCfg([]string{primaryFilter, recipe.Cmd})
+		if err != nil {
+			return err
+		}
+
+		ctx := newCfgContext(cfgCtx)
+
+		view, err := getDevicesView(ctx)
+		if err != nil {
+			return err
+		}
+
+		return runRemoteCommand(cmd, ctx, view)
+	},
+}
+
+// applyRecipe makes the recipe's settings the defaults, any of them given as a flag still wins. The filter is the
+// exception, a --filter narrows down the recipe's filter instead.
+func applyRecipe(cmd *cobra.Command, recipe pkg.Recipe) {
+	viper.Set("filter", recipe.CombinedFilter(viper.GetString("filter")))
+
+	if recipe.Concurrency > 0 && !cmd.Flags().Changed("concurrency") {
+		viper.Set("concurrency", recipe.Concurrency)
+	}
+
+	if len(recipe.Batch) > 0 && !cmd.Flags().Changed("batch") {
+		viper.Set("batch", recipe.Batch)
+	}
+
+	if recipe.Stderr && !cmd.Flags().Changed("stderr") {
+		viper.Set("stderr", true)
+	}
+
+	if recipe.Template && !cmd.Flags().Changed("template") {
+		viper.Set("template", true)
+	}
+}
@@ -3,13 +3,21 @@ package cmd
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
 	"strings"
 
 	"github.com/deckarep/tips/pkg/prefixcomp"
 
 	"github.com/deckarep/tips/pkg/slicecomp"
+	"github.com/deckarep/tips/pkg/tailscale_cli"
 
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/term"
 
 	"github.com/deckarep/tips/pkg"
 )
@@ -54,23 +62,62 @@ func packageCfg(args []string) (*pkg.ConfigCtx, error) {
 	// Populate flags
 	cfgCtx.Basic = viper.GetBool("basic")
 	cfgCtx.CacheTimeout = viper.GetDuration("cache_timeout")
+	cfgCtx.CmdTimeout = viper.GetDuration("cmd_timeout")
+	cfgCtx.Collapse = viper.GetBool("collapse")
+	cfgCtx.CollapseExitCode = viper.GetBool("collapse_exit_code")
 	incCols, exCols := pkg.ParseColumns(viper.GetString("columns"))
 	cfgCtx.Columns = incCols
 	cfgCtx.ColumnsExclude = exCols
 	cfgCtx.Concurrency = viper.GetInt("concurrency")
+	cfgCtx.ConfirmThreshold = viper.GetInt("confirm_threshold")
+	cfgCtx.Dashboard = viper.GetBool("dashboard")
+	cfgCtx.Deadline = viper.GetDuration("deadline")
+	cfgCtx.Detach = viper.GetBool("detach")
+	cfgCtx.DryRun = viper.GetBool("dry_run")
+	cfgCtx.Executor = viper.GetString("executor")
+	batchSize, err := pkg.ParseBatchSize(viper.GetString("batch"))
+	if err != nil {
+		return nil, err
+	}
+	cfgCtx.Rollout = pkg.RolloutStrategy{
+		Batch:       batchSize,
+		Canary:      viper.GetInt("canary"),
+		Pause:       viper.GetDuration("batch_pause"),
+		MaxFailures: viper.GetInt("max_failures"),
+	}
 	ast, err := pkg.ParseFilter(viper.GetString("filter"))
 	if err != nil {
 		return nil, err
 	}
 	cfgCtx.Filters = ast
+	cfgCtx.Grouped = viper.GetBool("grouped")
+	cfgCtx.GroupOrder = viper.GetString("group_order")
+	cfgCtx.HTTPBody = viper.GetBool("http_body")
+	cfgCtx.HTTPMethod = strings.ToUpper(strings.TrimSpace(viper.GetString("http")))
+	cfgCtx.HTTPTarget = viper.GetString("http_target")
 	cfgCtx.IPsOutput = viper.GetBool("ips")
 	cfgCtx.IPsDelimiter = viper.GetString("delimiter")
+	cfgCtx.JobID = viper.GetString("job_id")
+	cfgCtx.JobRetention = viper.GetDuration("job_retention")
+	// A detached runner never detaches again, even when the config file or env asks for it.
+	if len(cfgCtx.JobID) > 0 {
+		cfgCtx.Detach = false
+	}
 	cfgCtx.JsonOutput = viper.GetBool("json")
 	cfgCtx.Stderr = viper.GetBool("stderr")
+	cfgCtx.Template = viper.GetBool("template")
 	cfgCtx.NoCache = viper.GetBool("nocache")
+	cfgCtx.OutputDir = viper.GetString("output_dir")
 	// Disabling color for now, it's just not ready.
 	cfgCtx.NoColor = true //viper.GetBool("nocolor")
 	cfgCtx.Page = viper.GetInt("page")
+	ports, err := pkg.ParsePorts(viper.GetString("ports"))
+	if err != nil {
+		return nil, err
+	}
+	cfgCtx.Ports = ports
+	cfgCtx.ProbeTimeout = viper.GetDuration("probe_timeout")
+	cfgCtx.ProtectedTags = viper.GetStringSlice("protected_tags")
 
 	// When slice was provided in the prefix filter use that.
 	// But the --slice flag will override it.
@@ -87,17 +134,99 @@ func packageCfg(args []string) (*pkg.ConfigCtx, error) {
 		cfgCtx.Slice = prefixSlice
 	}
 
+	cfgCtx.Script = viper.GetString("script")
+	cfgCtx.SSH = viper.GetBool("ssh")
+	if err := viper.UnmarshalKey("ssh_settings", &cfgCtx.SSHSettings); err != nil {
+		return nil, fmt.Errorf("invalid ssh_settings in the config file: %w", err)
+	}
+	cfgCtx.CSSHX = viper.GetBool("csshx")
+	cfgCtx.Tmux = viper.GetBool("tmux")
+	cfgCtx.TmuxPanes = viper.GetInt("tmux_panes")
 	cfgCtx.SortOrder = pkg.ParseSortString(viper.GetString("sort"))
 	cfgCtx.Tailnet = viper.GetString("tailnet")
+	cfgCtx.TailscaleCLI.BinaryPath = viper.GetString("tailscale_binary")
+	cfgCtx.TailscaleCLI.Timeout = viper.GetDuration("cli_timeout")
 	cfgCtx.TailscaleAPI.ApiKey = viper.GetString("tips_api_key")
 	cfgCtx.TailscaleAPI.Timeout = viper.GetDuration("client_timeout")
 	cfgCtx.TestMode = viper.GetBool("test")
+	cfgCtx.Yes = viper.GetBool("yes")
 
 	// Validate flags
 	if cfgCtx.JsonOutput && cfgCtx.IPsOutput {
 		return nil, errors.New("the --ips and --json flag must not be used together. Choose one or the other.")
 	}
 
+	if cfgCtx.ConfirmThreshold < 0 {
+		return nil, errors.New("the confirm_threshold must not be negative")
+	}
+
+	if cfgCtx.Rollout.Canary < 0 || cfgCtx.Rollout.MaxFailures < 0 {
+		return nil, errors.New("the --canary and --max_failures flags must not be negative")
+	}
+
+	var sessions int
+	for _, on := range []bool{cfgCtx.SSH, cfgCtx.CSSHX, cfgCtx.Tmux} {
+		if on {
+			sessions++
+		}
+	}
+
+	if sessions > 1 {
+		return nil, errors.New("the --ssh, --csshx and --tmux flags must not be used together. Choose one of them.")
+	}
+
+	if len(cfgCtx.Script) > 0 && (cfgCtx.IsRemoteCommand() || sessions > 0) {
+		return nil, errors.New("the --script flag must not be given a remote command, pass any arguments for it after --")
+	}
+
+	if sessions > 0 && cfgCtx.DryRun {
+		return nil, errors.New("the --dry_run flag only applies to remote commands, scripts, cp and pull")
+	}
+
+	if sessions > 0 && cfgCtx.IsRemoteCommand() {
+		return nil, errors.New("the --ssh, --csshx and --tmux flags open interactive sessions and must not be given a remote command")
+	}
+
+	if len(cfgCtx.HTTPMethod) > 0 {
+		if len(cfgCtx.Script) > 0 || sessions > 0 {
+			return nil, errors.New("the --http flag must not be used together with --script, --ssh, --csshx or --tmux")
+		}
+
+		if !cfgCtx.IsRemoteCommand() {
+			return nil, errors.New("the --http flag requires a port and/or path to request: --http GET :8080/healthz")
+		}
+
+		if err = pkg.ValidateHTTPTarget(cfgCtx.HTTPTarget); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfgCtx.Detach && (sessions > 0 || cfgCtx.DryRun || cfgCtx.Dashboard) {
+		return nil, errors.New("the --detach flag must not be used together with --ssh, --csshx, --tmux, --dry_run or --dashboard")
+	}
+
+	if cfgCtx.Dashboard && (cfgCtx.JsonOutput || cfgCtx.Collapse || cfgCtx.Grouped) {
+		return nil, errors.New("the --dashboard flag must not be used together with --json, --collapse or --grouped.")
+	}
+
+	if cfgCtx.JsonOutput && (cfgCtx.Collapse || cfgCtx.Grouped) {
+		return nil, errors.New("the --json flag must not be used together with --collapse or --grouped, json output is always streamed.")
+	}
+
+	if cfgCtx.Collapse && cfgCtx.Grouped {
+		return nil, errors.New("the --collapse and --grouped flag must not be used together. Choose one or the other.")
+	}
+
+	if cfgCtx.Template {
+		if err = pkg.ValidateRemoteCmdTemplate(cfgCtx.RemoteCmd); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = pkg.ValidateGroupOrder(cfgCtx.GroupOrder); err != nil {
+		return nil, err
+	}
+
 	if strings.TrimSpace(cfgCtx.TailscaleAPI.ApiKey) == "" {
 		return nil,
 			errors.New("a 'tips_api_key' must be defined either as an environment variable (uppercase), in a config or as a --tips_api_key flag")
@@ -115,20 +244,238 @@ func getHosts(ctx context.Context, view *pkg.GeneralTableView) []pkg.RemoteCmdHo
 	cfg := pkg.CtxAsConfig(ctx, pkg.CtxKeyConfig)
 	var hosts []pkg.RemoteCmdHost
 
-	for _, rows := range view.Rows {
+	for i, rows := range view.Rows {
 		// TODO: getting back a GeneralTableView in this stage is not ideal, it's too abstract.
 		// Column's may change so this is dumb.
+		var host pkg.RemoteCmdHost
 		if cfg.TestMode {
-			hosts = append(hosts, pkg.RemoteCmdHost{
+			host = pkg.RemoteCmdHost{
 				Original: "blade",
 				Alias:    rows[1],
-			})
+			}
 		} else {
-			hosts = append(hosts, pkg.RemoteCmdHost{
+			host = pkg.RemoteCmdHost{
 				Original: rows[1],
-			})
+			}
 		}
+
+		// The device comes along so remote commands may reference its fields.
+		if i < len(view.Devices) {
+			host.Device = view.Devices[i]
+		}
+		hosts = append(hosts, host)
 	}
 
 	return hosts
 }
+
+// newCfgContext wraps the packaged config (and the user's query) into a context as expected by the pkg package.
+func newCfgContext(cfgCtx *pkg.ConfigCtx) context.Context {
+	tailscale_cli.SetBinaryPath(cfgCtx.TailscaleCLI.BinaryPath)
+
+	ctx := context.WithValue(context.Background(), pkg.CtxKeyConfig, cfgCtx)
+	// CONSIDER: should this show all flags?
+	return context.WithValue(ctx, pkg.CtxKeyUserQuery, fmt.Sprintf("%s %s", cfgCtx.PrefixFilter.Query(), cfgCtx.RemoteCmd))
+}
+
+// getDevicesView fetches the devices (cached when possible) and runs them through the filtering, sorting and slicing
+// pipeline, this is the selection every command operates on.
+func getDevicesView(ctx context.Context) (*pkg.GeneralTableView, error) {
+	cfgCtx := pkg.CtxAsConfig(ctx, pkg.CtxKeyConfig)
+
+	client := pkg.NewClient(ctx)
+	if useOauth {
+		client = pkg.NewOauthClient(ctx)
+	}
+
+	cachedDevRepo := pkg.NewCachedRepo(pkg.NewRemoteDeviceRepo(client))
+	var devicesResourceFunc = cachedDevRepo.DevicesResource
+
+	// In test mode, indirect to mocked test data.
+	// TODO: refactor this out as it doesn't belong here.
+	if cfgCtx.TestMode {
+		mockDevRepo := pkg.NewMockedDeviceRepo()
+		cachedDevRepo = pkg.NewCachedRepo(mockDevRepo)
+		devicesResourceFunc = cachedDevRepo.DevicesResource
+	}
+
+	devList, err := devicesResourceFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkg.ProcessDevicesTable(ctx, devList)
+}
+
+// splitScriptArgs splits off the arguments following -- when a --script was given, those are meant for the script.
+// Otherwise the args are left as is, as anything after -- is simply part of the remote command.
+func splitScriptArgs(cmd *cobra.Command, args []string) ([]string, []string) {
+	dash := cmd.ArgsLenAtDash()
+	if len(viper.GetString("script")) == 0 || dash < 0 {
+		return args, nil
+	}
+	return args[:dash], args[dash:]
+}
+
+// renderTable renders the view as a table, as simple ascii when --basic was given.
+func renderTable(ctx context.Context, view *pkg.GeneralTableView) error {
+	cfg := pkg.CtxAsConfig(ctx, pkg.CtxKeyConfig)
+	if cfg.Basic {
+		return pkg.RenderASCIITableView(ctx, view, os.Stdout)
+	}
+	return pkg.RenderTableView(ctx, view, os.Stdout)
+}
+
+// selectHost returns the one host matched by the view. When the selection is ambiguous the candidate table is
+// rendered so the user can pick one by its No.
+func selectHost(ctx context.Context, view *pkg.GeneralTableView) (pkg.RemoteCmdHost, error) {
+	hosts := getHosts(ctx, view)
+
+	switch len(hosts) {
+	case 0:
+		return pkg.RemoteCmdHost{}, errors.New("no hosts matched the query")
+	case 1:
+		return hosts[0], nil
+	}
+
+	if err := renderTable(ctx, view); err != nil {
+		return pkg.RemoteCmdHost{}, err
+	}
+
+	idx, err := pkg.PromptHostIndex(os.Stdin, os.Stdout, len(hosts))
+	if err != nil {
+		return pkg.RemoteCmdHost{}, err
+	}
+	return hosts[idx], nil
+}
+
+// startBroadcastSession opens a multi-pane session over the hosts. The --csshx flag prefers csshx, but as it's macOS
+// only tmux stands in for it whenever it's not installed.
+func startBroadcastSession(ctx context.Context, hosts []pkg.RemoteCmdHost) error {
+	cfg := pkg.CtxAsConfig(ctx, pkg.CtxKeyConfig)
+
+	if cfg.CSSHX {
+		if _, err := exec.LookPath("csshx"); err == nil {
+			return pkg.StartCSSHXSession(ctx, hosts)
+		}
+		log.Info("csshx is not installed, opening a tmux session instead")
+	}
+
+	executor, err := pkg.NewRemoteExecutor(ctx)
+	if err != nil {
+		return err
+	}
+
+	return pkg.StartTmuxSession(ctx, executor, hosts, cfg.TmuxPanes)
+}
+
+// beforeRun is the one path every run on remote hosts goes through before anything is executed, sessions included. It
+// prepares the --output_dir and enforces the guardrail policies. With --detach the run is then handed off to a job in
+// the background, in which case detached is true and there's nothing left for the caller to do.
+func beforeRun(ctx context.Context, hosts []pkg.RemoteCmdHost, desc string) (detached bool, err error) {
+	cfgCtx := pkg.CtxAsConfig(ctx, pkg.CtxKeyConfig)
+
+	if err = prepareOutputDir(cfgCtx); err != nil {
+		return false, err
+	}
+
+	if err = confirmRun(ctx, hosts, desc); err != nil {
+		return false, err
+	}
+
+	if cfgCtx.Detach {
+		return true, detachRun(ctx, hosts, desc)
+	}
+	return false, nil
+}
+
+// confirmRun enforces the guardrail policies before anything runs on the hosts. Only when stdin is a terminal is there
+// anyone to ask for confirmation, otherwise guarded runs require --yes. The prompt goes to stderr, keeping stdout to
+// the output of the run, such as the --json events.
+func confirmRun(ctx context.Context, hosts []pkg.RemoteCmdHost, desc string) error {
+	var r io.Reader
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		r = os.Stdin
+	}
+	return pkg.ConfirmRun(ctx, r, os.Stderr, hosts, desc)
+}
+
+// prepareOutputDir creates the --output_dir up front when one was given, so a remote run never goes ahead without the
+// transcript it was asked to record.
+func prepareOutputDir(cfgCtx *pkg.ConfigCtx) error {
+	// A dry run doesn't record anything.
+	if len(cfgCtx.OutputDir) == 0 || cfgCtx.DryRun {
+		return nil
+	}
+	return os.MkdirAll(cfgCtx.OutputDir, 0755)
+}
+
+// checkResults turns any unsuccessful host into an error, so tips exits non-zero and scripts and CI jobs can react to
+// partial failures. That includes hosts which never started because the run was cut short, an interrupted run's
+// error is always an ErrInterrupted.
+func checkResults(cmd *cobra.Command, what string, results pkg.RemoteCmdResults) error {
+	if unsuccessful := results.Unsuccessful(); len(unsuccessful) > 0 {
+		// The summary was already rendered, a usage dump would only bury it.
+		cmd.SilenceUsage = true
+		err := fmt.Errorf("%s failed on %d of %d hosts (%d timed out, %d interrupted, %d never started)", what,
+			len(unsuccessful), len(results), len(results.WithStatus(pkg.StatusTimedOut)),
+			len(results.WithStatus(pkg.StatusInterrupted)), len(results.CutShort()))
+		if results.Interrupted() {
+			return fmt.Errorf("%w: %w", pkg.ErrInterrupted, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// runRemoteCommand executes the configured remote command over all hosts of the view.
+func runRemoteCommand(cmd *cobra.Command, ctx context.Context, view *pkg.GeneralTableView) error {
+	cfgCtx := pkg.CtxAsConfig(ctx, pkg.CtxKeyConfig)
+	hosts := getHosts(ctx, view)
+
+	executor, err := pkg.NewRemoteExecutor(ctx)
+	if err != nil {
+		return err
+	}
+
+	if detached, err := beforeRun(ctx, hosts, "remote command: "+cfgCtx.RemoteCmd); detached || err != nil {
+		return err
+	}
+
+	// Do the remote cluster command.
+	results := pkg.ExecuteClusterRemoteCmd(ctx, os.Stdout, executor, hosts, cfgCtx.RemoteCmd)
+	return checkResults(cmd, "remote command", results)
+}
+
+// detachRun starts the very same run again as a job in the background, where it carries on even once this terminal
+// is gone. The job records its progress into the db, which `tips jobs` reads back.
+func detachRun(ctx context.Context, hosts []pkg.RemoteCmdHost, desc string) error {
+	cfg := pkg.CtxAsConfig(ctx, pkg.CtxKeyConfig)
+
+	job := pkg.NewJob(desc, cfg.PrefixFilter.Query(), hosts)
+	if err := pkg.StartDetachedJob(ctx, job, detachedArgs(os.Args[1:], job.ID)); err != nil {
+		return err
+	}
+
+	return pkg.RenderJobStarted(ctx, os.Stdout, job)
+}
+
+// detachedArgs turns the args of a detaching invocation into those of its runner: without --detach, recording into
+// the job and without asking for a confirmation again, as that already happened.
+func detachedArgs(args []string, jobID string) []string {
+	runnerArgs := make([]string, 0, len(args)+3)
+	for i, arg := range args {
+		if arg == "--" {
+			// Anything past -- is for a script, leave it be.
+			runnerArgs = append(runnerArgs, "--job_id", jobID, "--yes")
+			return append(runnerArgs, args[i:]...)
+		}
+
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && name == "detach" {
+			continue
+		}
+		runnerArgs = append(runnerArgs, arg)
+	}
+	return append(runnerArgs, "--job_id", jobID, "--yes")
+}
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/stretchr/testify/assert"
@@ -30,6 +32,23 @@ func TestPackageCfg(t *testing.T) {
 
 	assert.True(t, cfg.PrefixFilter.IsAll())
 	assert.Equal(t, cfg.RemoteCmd, "echo 'hello world' && sleep 0.5 && ps aux | grep foo")
+
+	// The ssh settings come straight from the config file.
+	viper.Set("ssh_settings", map[string]any{
+		"user":           "ops",
+		"options":        []string{"ServerAliveInterval=15"},
+		"control_master": true,
+		"tags":           map[string]any{"tag:db": map[string]any{"user": "postgres", "port": 2222}},
+	})
+	defer viper.Set("ssh_settings", nil)
+
+	cfg, err = packageCfg(args)
+	assert.NoError(t, err)
+	assert.Equal(t, pkg.SSHSettings{
+		SSHOptions:    pkg.SSHOptions{User: "ops", Options: []string{"ServerAliveInterval=15"}},
+		ControlMaster: true,
+		Tags:          map[string]pkg.SSHOptions{"tag:db": {User: "postgres", Port: 2222}},
+	}, cfg.SSHSettings)
 }
 
 func TestGetHosts(t *testing.T) {
@@ -66,4 +85,210 @@ func TestGetHosts(t *testing.T) {
 		{Original: "blade", Alias: "a1"},
 		{Original: "blade", Alias: "b1"},
 	})
+
+	// Each host carries the device backing its row.
+	tv.Devices = []*pkg.WrappedDevice{{}, {}}
+	hostList = getHosts(ctx, tv)
+	assert.Same(t, tv.Devices[0], hostList[0].Device)
+	assert.Same(t, tv.Devices[1], hostList[1].Device)
+}
+
+func TestSelectHost(t *testing.T) {
+	ctx := context.Background()
+	cfgCtx := pkg.NewConfigCtx()
+	ctx = context.WithValue(ctx, pkg.CtxKeyConfig, cfgCtx)
+
+	_, err := selectHost(ctx, &pkg.GeneralTableView{})
+	assert.Error(t, err, "nothing matched so there is nothing to select")
+
+	host, err := selectHost(ctx, &pkg.GeneralTableView{Rows: [][]string{{"0", "a1", "a2"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, pkg.RemoteCmdHost{Original: "a1"}, host, "a single match needs no picking")
+}
+
+// setViper sets the key for the duration of the test only. viper.Set wins over flags and the config file alike, so
+// leaving a value behind would silently pin it for every test that follows.
+func setViper(t *testing.T, key string, value any) {
+	t.Helper()
+
+	prev := viper.Get(key)
+	viper.Set(key, value)
+	t.Cleanup(func() {
+		// Clearing the override brings back the flag, env or config file value, unless an earlier override hid it.
+		viper.Set(key, nil)
+		if !reflect.DeepEqual(viper.Get(key), prev) {
+			viper.Set(key, prev)
+		}
+	})
+}
+
+func TestSplitScriptArgs(t *testing.T) {
+	cmd := &cobra.Command{}
+	assert.NoError(t, cmd.Flags().Parse([]string{"blade", "--", "arg1", "arg 2"}))
+	args := cmd.Flags().Args()
+
+	// Without a script, everything after -- is part of the remote command.
+	cfgArgs, scriptArgs := splitScriptArgs(cmd, args)
+	assert.Equal(t, []string{"blade", "arg1", "arg 2"}, cfgArgs)
+	assert.Nil(t, scriptArgs)
+
+	setViper(t, "script", "./fix.sh")
+	cfgArgs, scriptArgs = splitScriptArgs(cmd, args)
+	assert.Equal(t, []string{"blade"}, cfgArgs)
+	assert.Equal(t, []string{"arg1", "arg 2"}, scriptArgs)
+
+	// A script mustn't be combined with a remote command.
+	setViper(t, "tips_api_key", "foo")
+	setViper(t, "tailnet", "bar")
+	_, err := packageCfg([]string{"blade", "uptime"})
+	assert.Error(t, err)
+
+	cfg, err := packageCfg(cfgArgs)
+	assert.NoError(t, err)
+	assert.Equal(t, "./fix.sh", cfg.Script)
+}
+
+func TestPackageCfgHTTP(t *testing.T) {
+	setViper(t, "tips_api_key", "foo")
+	setViper(t, "tailnet", "bar")
+	setViper(t, "http_target", pkg.HTTPTargetIPv4)
+	setViper(t, "http", "get")
+
+	cfg, err := packageCfg([]string{"blade", ":8080/healthz"})
+	assert.NoError(t, err)
+	assert.Equal(t, "GET", cfg.HTTPMethod)
+	assert.Equal(t, ":8080/healthz", cfg.RemoteCmd)
+
+	_, err = packageCfg([]string{"blade"})
+	assert.Error(t, err, "a port and/or path is required")
+
+	setViper(t, "http_target", "ipv6")
+	_, err = packageCfg([]string{"blade", ":8080/healthz"})
+	assert.Error(t, err, "unknown http target")
+}
+
+func TestDetachedArgs(t *testing.T) {
+	assert.Equal(t, []string{"blade", "uptime", "-c", "20", "--job_id", "j1", "--yes"},
+		detachedArgs([]string{"blade", "uptime", "--detach", "-c", "20"}, "j1"))
+
+	assert.Equal(t, []string{"cp", "blade", "./a", "/tmp", "--job_id", "j1", "--yes"},
+		detachedArgs([]string{"cp", "blade", "./a", "/tmp", "--detach=true"}, "j1"))
+
+	// Anything past -- belongs to the script, even when it looks like --detach.
+	assert.Equal(t, []string{"blade", "--script", "./fix.sh", "--job_id", "j1", "--yes", "--", "--detach"},
+		detachedArgs([]string{"blade", "--detach", "--script", "./fix.sh", "--", "--detach"}, "j1"))
+}
+
+func TestApplyRecipe(t *testing.T) {
+	setViper(t, "tips_api_key", "foo")
+	setViper(t, "tailnet", "bar")
+	// applyRecipe sets these, restoring them is up to the test.
+	for _, key := range []string{"filter", "concurrency", "batch", "stderr", "template"} {
+		setViper(t, key, viper.Get(key))
+	}
+
+	recipe := pkg.Recipe{Cmd: "curl -s http://{{.IPv4}}:9100", Filter: "tag:web", Concurrency: 2, Batch: "50%", Stderr: true,
+		Template: true}
+
+	// A flag given by the user wins over the recipe, the filter narrows the recipe's down instead.
+	cmd := &cobra.Command{}
+	cmd.Flags().Int("concurrency", 5, "")
+	assert.NoError(t, cmd.Flags().Parse([]string{"--concurrency", "10"}))
+	setViper(t, "concurrency", 10)
+	setViper(t, "filter", "tag:prod")
+
+	applyRecipe(cmd, recipe)
+
+	cfg, err := packageCfg([]string{"@", recipe.Cmd})
+	assert.NoError(t, err)
+	assert.Equal(t, "curl -s http://{{.IPv4}}:9100", cfg.RemoteCmd)
+	assert.Equal(t, 10, cfg.Concurrency)
+	assert.True(t, cfg.Stderr)
+	assert.True(t, cfg.Template)
+	assert.Equal(t, "(tag:web),(tag:prod)", viper.GetString("filter"))
+	assert.Equal(t, "50%", viper.GetString("batch"))
+}
+
+func TestPackageCfgDetachedRunner(t *testing.T) {
+	setViper(t, "tips_api_key", "foo")
+	setViper(t, "tailnet", "bar")
+	// As if set by the config file or a DETACH env var, which the runner sees just the same.
+	setViper(t, "detach", true)
+
+	cfg, err := packageCfg([]string{"blade", "uptime"})
+	assert.NoError(t, err)
+	assert.True(t, cfg.Detach)
+
+	// The runner mustn't detach yet again, or every runner would start another one.
+	setViper(t, "job_id", "j1")
+	cfg, err = packageCfg([]string{"blade", "uptime"})
+	assert.NoError(t, err)
+	assert.False(t, cfg.Detach)
+	assert.Equal(t, "j1", cfg.JobID)
+}
+
+func TestCheckResults(t *testing.T) {
+	cmd := &cobra.Command{}
+
+	results := pkg.RemoteCmdResults{
+		{Idx: 0, Status: pkg.StatusSucceeded},
+		// Skipped on purpose, such as by a halted rollout.
+		{Idx: 1, Status: pkg.StatusSkipped},
+	}
+	assert.NoError(t, checkResults(cmd, "remote command", results))
+
+	// Skipped as the deadline passed, part of the fleet never ran.
+	results = append(results, &pkg.RemoteCmdResult{Idx: 2, Status: pkg.StatusSkipped, Err: pkg.ErrDeadlineReached})
+	assert.EqualError(t, checkResults(cmd, "remote command", results),
+		"remote command failed on 1 of 3 hosts (0 timed out, 0 interrupted, 1 never started)")
+
+	// An interrupt always tells, even when no host was running at the time.
+	results[2].Err = pkg.ErrInterrupted
+	assert.ErrorIs(t, checkResults(cmd, "remote command", results), pkg.ErrInterrupted)
+}
+
+func TestPackageCfgTemplate(t *testing.T) {
+	setViper(t, "tips_api_key", "foo")
+	setViper(t, "tailnet", "bar")
+
+	// Commands which carry braces of their own pass through untouched.
+	for _, remoteCmd := range []string{
+		"docker ps --format '{{.Names}}'",
+		"kubectl get pods -o go-template='{{range .items}}{{.metadata.name}}{{end}}'",
+	} {
+		cfg, err := packageCfg([]string{"blade", remoteCmd})
+		assert.NoError(t, err)
+		assert.False(t, cfg.Template)
+		assert.Equal(t, remoteCmd, cfg.RemoteCmd)
+	}
+
+	// Templating is opt-in, only then is the command checked as a template.
+	setViper(t, "template", true)
+	cfg, err := packageCfg([]string{"blade", "curl http://{{.IPv4}}:9100"})
+	assert.NoError(t, err)
+	assert.True(t, cfg.Template)
+
+	_, err = packageCfg([]string{"blade", "docker ps --format '{{.Names}}'"})
+	assert.Error(t, err, "there's no such field")
+}
+
+func TestBeforeRun(t *testing.T) {
+	cfgCtx := pkg.NewConfigCtx()
+	cfgCtx.ProtectedTags = []string{"prod"}
+	ctx := context.WithValue(context.Background(), pkg.CtxKeyConfig, cfgCtx)
+
+	hosts := []pkg.RemoteCmdHost{{Original: "blade-01", Device: &pkg.WrappedDevice{}}}
+
+	detached, err := beforeRun(ctx, hosts, "broadcast session")
+	assert.NoError(t, err)
+	assert.False(t, detached)
+
+	// A protected host requires a confirmation, which nobody can give without a terminal.
+	hosts[0].Device.Tags = []string{"tag:prod"}
+	_, err = beforeRun(ctx, hosts, "broadcast session")
+	assert.ErrorIs(t, err, pkg.ErrConfirmationRequired)
+
+	cfgCtx.Yes = true
+	_, err = beforeRun(ctx, hosts, "broadcast session")
+	assert.NoError(t, err)
 }
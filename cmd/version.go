@@ -36,6 +36,7 @@ import (
 	"github.com/deckarep/tips/pkg"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 func init() {
@@ -47,6 +48,7 @@ var versionCmd = &cobra.Command{
 	Short: pkg.AppShortName + " empowers you to wrangle your Tailnet",
 	Long:  pkg.AppLongName + " empowers you to manage your Tailscale cluster like a pro",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		tailscale_cli.SetBinaryPath(viper.GetString("tailscale_binary"))
 		return printVersion(os.Stdout, tailscale_cli.GetVersion)
 	},
 }
@@ -0,0 +1,141 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// DefaultTmuxPanes is the default number of panes per tmux window, beyond this the panes get too small to use.
+	DefaultTmuxPanes = 16
+)
+
+// StartCSSHXSession opens a csshx session over all hosts, a window per host with input broadcast to all of them. It
+// blocks until csshx exits.
+func StartCSSHXSession(ctx context.Context, hosts []RemoteCmdHost) error {
+	binPath, err := exec.LookPath("csshx")
+	if err != nil {
+		return err
+	}
+
+	args := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		args = append(args, h.Original)
+	}
+
+	return runAttached(ctx, binPath, args...)
+}
+
+// StartTmuxSession opens a new tmux session with one pane per host, each running an interactive session via the
+// executor. Panes are spread over as many windows as needed to hold at most panesPerWindow each and the panes of a
+// window are synchronized, so whatever is typed goes to every host in that window. It blocks until the session is
+// detached from or ends.
+func StartTmuxSession(ctx context.Context, executor RemoteExecutor, hosts []RemoteCmdHost, panesPerWindow int) error {
+	if len(hosts) == 0 {
+		return errors.New("no hosts to open a tmux session on")
+	}
+
+	// Every pane runs its own process, so the executor has to be one that forks a binary.
+	cmdExec, ok := executor.(*CmdExecutor)
+	if !ok {
+		return fmt.Errorf("the %s executor can't be used for tmux panes, use the ssh or tailscale executor", executor.Name())
+	}
+
+	tmuxPath, err := exec.LookPath("tmux")
+	if err != nil {
+		return err
+	}
+
+	paneCmds := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		paneCmds = append(paneCmds, cmdExec.Describe(h.Original, &ExecRequest{Tty: true, Tags: h.Tags()}))
+	}
+
+	session := fmt.Sprintf("tips-%d", time.Now().Unix())
+	for _, args := range TmuxCommands(session, paneCmds, panesPerWindow) {
+		if out, err := exec.CommandContext(ctx, tmuxPath, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("tmux %s failed: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	log.Info("opened tmux session", "session", session, "hosts", len(hosts), "panesPerWindow", panesPerWindow)
+
+	// From within tmux already, just switch over to the new session instead of nesting it.
+	if len(os.Getenv("TMUX")) > 0 {
+		return runAttached(ctx, tmuxPath, "switch-client", "-t", session)
+	}
+	return runAttached(ctx, tmuxPath, "attach-session", "-t", session)
+}
+
+// TmuxCommands returns the tmux invocations, as arguments, which build a detached session with a pane per command.
+// Windows are named hosts-1, hosts-2 and so on, each holding at most panesPerWindow panes which are synchronized.
+func TmuxCommands(session string, paneCmds []string, panesPerWindow int) [][]string {
+	if panesPerWindow < 1 {
+		panesPerWindow = DefaultTmuxPanes
+	}
+
+	var cmds [][]string
+	for start := 0; start < len(paneCmds); start += panesPerWindow {
+		end := min(start+panesPerWindow, len(paneCmds))
+		window := fmt.Sprintf("hosts-%d", start/panesPerWindow+1)
+		target := session + ":" + window
+
+		if start == 0 {
+			cmds = append(cmds, []string{"new-session", "-d", "-s", session, "-n", window, paneCmds[start]})
+		} else {
+			cmds = append(cmds, []string{"new-window", "-t", session, "-n", window, paneCmds[start]})
+		}
+
+		for _, paneCmd := range paneCmds[start+1 : end] {
+			cmds = append(cmds,
+				[]string{"split-window", "-t", target, paneCmd},
+				// Re-tile after every split, otherwise tmux runs out of room for the next pane.
+				[]string{"select-layout", "-t", target, "tiled"})
+		}
+
+		cmds = append(cmds, []string{"set-window-option", "-t", target, "synchronize-panes", "on"})
+	}
+
+	return cmds
+}
+
+// runAttached runs the binary with the local terminal attached.
+func runAttached(ctx context.Context, binPath string, args ...string) error {
+	c := exec.CommandContext(ctx, binPath, args...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
@@ -0,0 +1,61 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTmuxCommands(t *testing.T) {
+	cmds := TmuxCommands("tips-1", []string{"ssh a", "ssh b", "ssh c", "ssh d", "ssh e"}, 2)
+	assert.Equal(t, [][]string{
+		{"new-session", "-d", "-s", "tips-1", "-n", "hosts-1", "ssh a"},
+		{"split-window", "-t", "tips-1:hosts-1", "ssh b"},
+		{"select-layout", "-t", "tips-1:hosts-1", "tiled"},
+		{"set-window-option", "-t", "tips-1:hosts-1", "synchronize-panes", "on"},
+		{"new-window", "-t", "tips-1", "-n", "hosts-2", "ssh c"},
+		{"split-window", "-t", "tips-1:hosts-2", "ssh d"},
+		{"select-layout", "-t", "tips-1:hosts-2", "tiled"},
+		{"set-window-option", "-t", "tips-1:hosts-2", "synchronize-panes", "on"},
+		{"new-window", "-t", "tips-1", "-n", "hosts-3", "ssh e"},
+		{"set-window-option", "-t", "tips-1:hosts-3", "synchronize-panes", "on"},
+	}, cmds)
+
+	// Without a sensible cap the default is used.
+	cmds = TmuxCommands("tips-1", []string{"ssh a", "ssh b"}, 0)
+	assert.Len(t, cmds, 4, "both hosts fit in a single window")
+}
+
+func TestStartTmuxSessionRequiresCmdExecutor(t *testing.T) {
+	err := StartTmuxSession(context.Background(), &fakeExecutor{}, []RemoteCmdHost{{Original: "blade"}}, 4)
+	assert.ErrorContains(t, err, "the fake executor can't be used for tmux panes")
+
+	err = StartTmuxSession(context.Background(), &fakeExecutor{}, nil, 4)
+	assert.Error(t, err, "there must be at least one host")
+}
@@ -52,30 +52,64 @@ type TailscaleAPICfgCtx struct {
 }
 
 type TailscaleCLICfgCtx struct {
+	// BinaryPath overrides where the Tailscale cli is looked for.
+	BinaryPath string
+	// Timeout bounds a single call of the Tailscale cli, such as a ping.
+	Timeout time.Duration
 }
 
 type ConfigCtx struct {
-	Basic          bool
-	CacheTimeout   time.Duration
-	Columns        mapset.Set[string]
-	ColumnsExclude mapset.Set[string]
-	Concurrency    int
-	Filters        filtercomp.AST
-	IPsOutput      bool
-	IPsDelimiter   string
-	JsonOutput     bool
-	NoCache        bool
-	NoColor        bool
-	PrefixFilter   *prefixcomp.PrimaryFilterAST
-	RemoteCmd      string
-	Slice          *slicecomp.Slice
-	SortOrder      []SortSpec
-	Stderr         bool
-	Tailnet        string
-	CachedElapsed  time.Duration
-	TailscaleAPI   TailscaleAPICfgCtx
-	TailscaleCLI   TailscaleCLICfgCtx
-	Page           int
+	Basic            bool
+	CacheTimeout     time.Duration
+	CmdTimeout       time.Duration
+	Collapse         bool
+	CollapseExitCode bool
+	Columns          mapset.Set[string]
+	ColumnsExclude   mapset.Set[string]
+	ConfirmThreshold int
+	CSSHX            bool
+	Dashboard        bool
+	Concurrency      int
+	Deadline         time.Duration
+	Detach           bool
+	DryRun           bool
+	Executor         string
+	Filters          filtercomp.AST
+	Grouped          bool
+	GroupOrder       string
+	HTTPBody         bool
+	HTTPMethod       string
+	HTTPTarget       string
+	IPsOutput        bool
+	IPsDelimiter     string
+	JobID            string
+	JobRetention     time.Duration
+	JsonOutput       bool
+	NoCache          bool
+	NoColor          bool
+	OutputDir        string
+	Ports            []int
+	PrefixFilter     *prefixcomp.PrimaryFilterAST
+	ProbeTimeout     time.Duration
+	ProtectedTags    []string
+	RemoteCmd        string
+	Rollout          RolloutStrategy
+	Script           string
+	ScriptArgs       []string
+	Slice            *slicecomp.Slice
+	SSH              bool
+	SSHSettings      SSHSettings
+	SortOrder        []SortSpec
+	Stderr           bool
+	Template         bool
+	Tmux             bool
+	TmuxPanes        int
+	Tailnet          string
+	CachedElapsed    time.Duration
+	TailscaleAPI     TailscaleAPICfgCtx
+	TailscaleCLI     TailscaleCLICfgCtx
+	Page             int
+	Yes              bool
 
 	TestMode bool
 }
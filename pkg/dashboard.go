@@ -0,0 +1,429 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/deckarep/tips/pkg/ui"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	dashboardTick = time.Millisecond * 250
+	// dashboardMaxNameWidth bounds the host name column.
+	dashboardMaxNameWidth  = 30
+	dashboardProgressWidth = 30
+)
+
+type (
+	dashboardTickMsg     time.Time
+	dashboardStartedMsg  struct{ idx int }
+	dashboardDoneMsg     struct{ res *RemoteCmdResult }
+	dashboardFinishedMsg struct{ results RemoteCmdResults }
+)
+
+// dashboardHost is the state of a single host as shown on the dashboard.
+type dashboardHost struct {
+	idx       int
+	host      RemoteCmdHost
+	startTime time.Time
+	lines     []hostLine
+	// res is set once the host completed, or once the run is over for hosts which never started.
+	res *RemoteCmdResult
+}
+
+func (h *dashboardHost) state() string {
+	switch {
+	case h.res != nil:
+		return h.res.Status.String()
+	case !h.startTime.IsZero():
+		return "running"
+	default:
+		return "queued"
+	}
+}
+
+func (h *dashboardHost) elapsed(now time.Time) time.Duration {
+	switch {
+	case h.res != nil && !h.res.StartTime.IsZero():
+		return h.res.Elapsed()
+	case h.res == nil && !h.startTime.IsZero():
+		return now.Sub(h.startTime)
+	default:
+		return 0
+	}
+}
+
+// dashboardModel is the bubbletea model of the dashboard: a list of every host with its state, elapsed time and last
+// line of output, beneath the overall progress. Any host can be expanded to scroll through its full output.
+type dashboardModel struct {
+	hosts     []*dashboardHost
+	startTime time.Time
+	now       time.Time
+	cursor    int
+	expanded  bool
+	finished  bool
+	width     int
+	height    int
+	// scroll is the first line of output shown by the expanded host, unless it follows the output as it arrives.
+	scroll int
+	follow bool
+	// interrupt is invoked when Ctrl-C is pressed while the run is still going.
+	interrupt func()
+}
+
+func newDashboardModel(hosts []RemoteCmdHost, interrupt func()) *dashboardModel {
+	m := &dashboardModel{
+		startTime: time.Now(),
+		now:       time.Now(),
+		width:     120,
+		height:    24,
+		interrupt: interrupt,
+	}
+	for i, h := range hosts {
+		m.hosts = append(m.hosts, &dashboardHost{idx: i, host: h})
+	}
+	return m
+}
+
+func (m *dashboardModel) Init() tea.Cmd {
+	return dashboardTickCmd()
+}
+
+func dashboardTickCmd() tea.Cmd {
+	return tea.Tick(dashboardTick, func(t time.Time) tea.Msg {
+		return dashboardTickMsg(t)
+	})
+}
+
+func (m *dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+	case dashboardTickMsg:
+		m.now = time.Time(msg)
+		if !m.finished {
+			return m, dashboardTickCmd()
+		}
+	case dashboardStartedMsg:
+		m.hosts[msg.idx].startTime = time.Now()
+	case hostLine:
+		h := m.hosts[msg.idx]
+		// Every line is kept, just like the result keeps the host's entire output, the expanded view shows it in full.
+		h.lines = append(h.lines, msg)
+	case dashboardDoneMsg:
+		m.hosts[msg.res.Idx].res = msg.res
+	case dashboardFinishedMsg:
+		m.finished = true
+		m.now = time.Now()
+		for _, res := range msg.results {
+			if res != nil && m.hosts[res.Idx].res == nil {
+				m.hosts[res.Idx].res = res
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *dashboardModel) handleKey(msg tea.KeyMsg) tea.Cmd {
+	if m.expanded && len(m.hosts) > 0 && m.handleScrollKey(msg) {
+		return nil
+	}
+
+	switch msg.String() {
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = min(m.cursor+1, len(m.hosts)-1)
+	case "pgup":
+		m.cursor = max(m.cursor-m.listHeight(), 0)
+	case "pgdown":
+		m.cursor = min(m.cursor+m.listHeight(), len(m.hosts)-1)
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.hosts) - 1
+	case "enter", " ":
+		m.expanded = !m.expanded
+		// An expanded host starts out following its latest output.
+		m.follow = true
+	case "esc":
+		m.expanded = false
+	case "q":
+		if m.finished {
+			return tea.Quit
+		}
+	case "ctrl+c":
+		if m.finished {
+			return tea.Quit
+		}
+		// Goes through the very same handling as an interrupt without the dashboard.
+		m.interrupt()
+	}
+	return nil
+}
+
+// handleScrollKey scrolls through the output of the expanded host, reporting whether the key was one for scrolling.
+// Scrolling all the way down follows the output again as it arrives.
+func (m *dashboardModel) handleScrollKey(msg tea.KeyMsg) bool {
+	lastFirst := m.lastFirstLine(m.hosts[m.cursor])
+	if m.follow {
+		m.scroll = lastFirst
+	}
+
+	switch msg.String() {
+	case "up", "k":
+		m.scroll--
+	case "down", "j":
+		m.scroll++
+	case "pgup":
+		m.scroll -= m.outputHeight()
+	case "pgdown":
+		m.scroll += m.outputHeight()
+	case "home", "g":
+		m.scroll = 0
+	case "end", "G":
+		m.scroll = lastFirst
+	default:
+		return false
+	}
+
+	m.scroll = max(0, min(m.scroll, lastFirst))
+	m.follow = m.scroll == lastFirst
+	return true
+}
+
+// outputHeight is how many lines of output the expanded host shows beneath its own header.
+func (m *dashboardModel) outputHeight() int {
+	return max(m.listHeight()-1, 1)
+}
+
+// lastFirstLine is the first line shown once scrolled all the way down the output of the host.
+func (m *dashboardModel) lastFirstLine(h *dashboardHost) int {
+	return max(len(h.lines)-m.outputHeight(), 0)
+}
+
+// listHeight is how many rows of hosts fit beneath the header and above the footer.
+func (m *dashboardModel) listHeight() int {
+	return max(m.height-4, 1)
+}
+
+func (m *dashboardModel) View() string {
+	var b strings.Builder
+
+	b.WriteString(m.progressView())
+	b.WriteString("\n\n")
+
+	if m.expanded && len(m.hosts) > 0 {
+		b.WriteString(m.hostView(m.hosts[m.cursor]))
+	} else {
+		b.WriteString(m.listView())
+	}
+
+	help := "↑/↓ select • enter expand/collapse"
+	if m.expanded {
+		help = "↑/↓ pgup/pgdown scroll • enter/esc collapse"
+	}
+	if m.finished {
+		help += " • q quit"
+	} else {
+		help += " • ctrl+c interrupt"
+	}
+	b.WriteString("\n" + ui.Styles.Faint.Render(help))
+
+	return b.String()
+}
+
+func (m *dashboardModel) progressView() string {
+	counts := make(map[string]int)
+	for _, h := range m.hosts {
+		counts[h.state()]++
+	}
+	done := len(m.hosts) - counts["queued"] - counts["running"]
+
+	filled := 0
+	if len(m.hosts) > 0 {
+		filled = done * dashboardProgressWidth / len(m.hosts)
+	}
+	bar := ui.Styles.Green.Render(strings.Repeat("█", filled)) +
+		ui.Styles.Faint.Render(strings.Repeat("░", dashboardProgressWidth-filled))
+
+	parts := []string{fmt.Sprintf("%d/%d done", done, len(m.hosts))}
+	for _, state := range []string{"running", "queued", StatusSucceeded.String(), StatusFailed.String(),
+		StatusTimedOut.String(), StatusInterrupted.String(), StatusSkipped.String()} {
+		if counts[state] > 0 {
+			parts = append(parts, dashboardStateStyle(state).Render(fmt.Sprintf("%s: %d", state, counts[state])))
+		}
+	}
+
+	elapsed := m.now.Sub(m.startTime).Round(time.Second)
+	return fmt.Sprintf("%s %s, elapsed: %s", bar, strings.Join(parts, ", "), elapsed)
+}
+
+func (m *dashboardModel) listView() string {
+	nameWidth := 0
+	for _, h := range m.hosts {
+		nameWidth = max(nameWidth, runewidth.StringWidth(hostDisplayName(h.host)))
+	}
+	nameWidth = min(nameWidth, dashboardMaxNameWidth)
+
+	// The window of rows follows the cursor.
+	rows := m.listHeight()
+	first := max(0, min(m.cursor-rows/2, len(m.hosts)-rows))
+	last := min(first+rows, len(m.hosts))
+
+	var b strings.Builder
+	for i := first; i < last; i++ {
+		h := m.hosts[i]
+
+		marker := "  "
+		if i == m.cursor {
+			marker = ui.Styles.Cyan.Render("▸ ")
+		}
+
+		name := runewidth.FillRight(runewidth.Truncate(hostDisplayName(h.host), nameWidth, "…"), nameWidth)
+		state := fmt.Sprintf("%-11s", h.state())
+		elapsed := fmt.Sprintf("%7.1fs", h.elapsed(m.now).Seconds())
+
+		var lastLine string
+		if len(h.lines) > 0 {
+			lastLine = h.lines[len(h.lines)-1].line
+		}
+		// What remains of the width after the marker, name, state and elapsed columns with their separators.
+		lastLine = runewidth.Truncate(lastLine, max(m.width-nameWidth-25, 10), "…")
+
+		b.WriteString(fmt.Sprintf("%s%s  %s %s  %s\n", marker, name, dashboardStateStyle(h.state()).Render(state),
+			elapsed, ui.Styles.Faint.Render(lastLine)))
+	}
+	return b.String()
+}
+
+// hostView is the expanded view of a single host, showing the window of its output it's scrolled to. Unless scrolled
+// up, that's its most recent output.
+func (m *dashboardModel) hostView(h *dashboardHost) string {
+	var b strings.Builder
+
+	first := m.lastFirstLine(h)
+	if !m.follow {
+		first = min(m.scroll, first)
+	}
+	last := min(first+m.outputHeight(), len(h.lines))
+
+	position := "no output yet"
+	if len(h.lines) > 0 {
+		position = fmt.Sprintf("lines %d-%d of %d", first+1, last, len(h.lines))
+	}
+
+	b.WriteString(fmt.Sprintf("%s %s %s, elapsed: %.1fs %s\n",
+		ui.Styles.Faint.Render("==="),
+		ui.Styles.Cyan.Render(fmt.Sprintf("%s (%d):", hostDisplayName(h.host), h.idx)),
+		dashboardStateStyle(h.state()).Render(h.state()),
+		h.elapsed(m.now).Seconds(),
+		ui.Styles.Faint.Render("("+position+")")))
+
+	for _, hl := range h.lines[first:last] {
+		line := runewidth.Truncate(hl.line, max(m.width-3, 10), "…")
+		if hl.stderr {
+			line = ui.Styles.Yellow.Render(">2 ") + line
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+func dashboardStateStyle(state string) lipgloss.Style {
+	switch state {
+	case "running":
+		return ui.Styles.Cyan
+	case StatusSucceeded.String():
+		return ui.Styles.Green
+	case StatusFailed.String(), StatusTimedOut.String():
+		return ui.Styles.Red
+	case StatusInterrupted.String(), StatusSkipped.String():
+		return ui.Styles.Yellow
+	default:
+		return ui.Styles.Faint
+	}
+}
+
+// dashboardOutput renders the run as a live dashboard rather than streaming the output, see dashboardModel. Once the
+// run is over the dashboard stays up until dismissed, so the outcome of each host can still be looked into.
+type dashboardOutput struct {
+	program *tea.Program
+	done    chan struct{}
+	// logLevel is restored once the dashboard is gone, logging in the meantime would garble it.
+	logLevel log.Level
+}
+
+func newDashboardOutput(ctx context.Context, w io.Writer, hosts []RemoteCmdHost) *dashboardOutput {
+	d := &dashboardOutput{
+		// Signals are left to the run's interrupt handler, which is also handed the Ctrl-C pressed on the dashboard.
+		program: tea.NewProgram(newDashboardModel(hosts, interruptFunc(ctx)), tea.WithOutput(w),
+			tea.WithoutSignalHandler()),
+		done:     make(chan struct{}),
+		logLevel: log.GetLevel(),
+	}
+	log.SetLevel(log.FatalLevel)
+
+	go func() {
+		defer close(d.done)
+		if _, err := d.program.Run(); err != nil {
+			log.SetLevel(d.logLevel)
+			log.Error("error running the dashboard", "error", err)
+		}
+	}()
+
+	return d
+}
+
+func (d *dashboardOutput) hostStarted(ctx context.Context, idx int) {
+	d.program.Send(dashboardStartedMsg{idx: idx})
+}
+
+func (d *dashboardOutput) line(ctx context.Context, hl hostLine) {
+	d.program.Send(hl)
+}
+
+func (d *dashboardOutput) hostDone(ctx context.Context, res *RemoteCmdResult) {
+	d.program.Send(dashboardDoneMsg{res: res})
+}
+
+func (d *dashboardOutput) finish(ctx context.Context, results RemoteCmdResults) {
+	d.program.Send(dashboardFinishedMsg{results: results})
+	<-d.done
+	log.SetLevel(d.logLevel)
+}
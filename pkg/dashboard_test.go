@@ -0,0 +1,147 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDashboardModel(t *testing.T) {
+	var interrupts int
+	hosts := []RemoteCmdHost{{Original: "blade-0001"}, {Original: "blade-0002"}, {Original: "blade", Alias: "peanut"}}
+	m := newDashboardModel(hosts, func() { interrupts++ })
+
+	assert.Equal(t, "queued", m.hosts[0].state())
+
+	m.Update(dashboardStartedMsg{idx: 0})
+	m.Update(dashboardStartedMsg{idx: 1})
+	m.Update(hostLine{idx: 0, line: "first"})
+	m.Update(hostLine{idx: 0, line: "up 3 days", stderr: true})
+	assert.Equal(t, "running", m.hosts[0].state())
+
+	view := m.View()
+	assert.Contains(t, view, "0/3 done")
+	assert.Contains(t, view, "running: 2")
+	assert.Contains(t, view, "queued: 1")
+	assert.Contains(t, view, "up 3 days", "the last line of each host is shown")
+	assert.NotContains(t, view, "first")
+	assert.Contains(t, view, "peanut", "hosts are shown by their alias")
+
+	m.Update(dashboardDoneMsg{res: &RemoteCmdResult{Idx: 1, Host: hosts[1], Status: StatusFailed, ExitCode: 2}})
+	assert.Equal(t, "failed", m.hosts[1].state())
+
+	// Ctrl-C interrupts the run rather than quitting the dashboard, q does nothing until the run is over.
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	assert.Nil(t, cmd)
+	assert.Equal(t, 1, interrupts)
+	_, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+	assert.Nil(t, cmd)
+
+	// Expanding a host shows its full output.
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	view = m.View()
+	assert.Contains(t, view, "blade-0001 (0):")
+	assert.Contains(t, view, "first")
+	assert.Contains(t, view, ">2 up 3 days")
+
+	m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	assert.Equal(t, 2, m.cursor, "the cursor stops at the last host")
+
+	// Hosts that never started are only known once the run is over.
+	m.Update(dashboardDoneMsg{res: &RemoteCmdResult{Idx: 0, Host: hosts[0], Status: StatusSucceeded,
+		StartTime: time.Now(), EndTime: time.Now()}})
+	m.Update(dashboardFinishedMsg{results: RemoteCmdResults{m.hosts[0].res, m.hosts[1].res, skippedResult(2, hosts[2], nil)}})
+	view = m.View()
+	assert.Contains(t, view, "3/3 done")
+	assert.Contains(t, view, "skipped: 1")
+	assert.True(t, strings.Contains(view, "q quit"))
+
+	_, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+	assert.NotNil(t, cmd, "q quits once the run is over")
+}
+
+func TestDashboardModelKeepsFullOutput(t *testing.T) {
+	m := newDashboardModel([]RemoteCmdHost{{Original: "a"}}, func() {})
+	for i := 0; i < 5000; i++ {
+		m.Update(hostLine{idx: 0, line: fmt.Sprintf("line-%d", i)})
+	}
+	assert.Len(t, m.hosts[0].lines, 5000)
+
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m.Update(tea.KeyMsg{Type: tea.KeyHome})
+	view := m.View()
+	assert.Contains(t, view, "line-0\n")
+	assert.Contains(t, view, "of 5000")
+}
+
+func TestDashboardModelScrollsExpandedOutput(t *testing.T) {
+	m := newDashboardModel([]RemoteCmdHost{{Original: "a"}}, func() {})
+	m.Update(tea.WindowSizeMsg{Width: 80, Height: 10})
+	for i := 0; i < 50; i++ {
+		m.Update(hostLine{idx: 0, line: fmt.Sprintf("line-%02d", i)})
+	}
+	rows := m.outputHeight()
+
+	// Expanding follows the most recent output.
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	view := m.View()
+	assert.Contains(t, view, "line-49")
+	assert.NotContains(t, view, "line-00")
+	assert.Contains(t, view, fmt.Sprintf("lines %d-50 of 50", 50-rows+1))
+
+	// All the way up to the very first line.
+	m.Update(tea.KeyMsg{Type: tea.KeyHome})
+	view = m.View()
+	assert.Contains(t, view, "line-00")
+	assert.NotContains(t, view, "line-49")
+
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	view = m.View()
+	assert.NotContains(t, view, "line-00")
+	assert.Contains(t, view, "line-01")
+
+	// Scrolled up, new output doesn't move the view.
+	m.Update(hostLine{idx: 0, line: "line-50"})
+	assert.Contains(t, m.View(), "line-01")
+
+	m.Update(tea.KeyMsg{Type: tea.KeyPgDown})
+	assert.Contains(t, m.View(), fmt.Sprintf("line-%02d", 1+rows))
+
+	// Back at the bottom, it follows the output again.
+	m.Update(tea.KeyMsg{Type: tea.KeyEnd})
+	m.Update(hostLine{idx: 0, line: "line-51"})
+	assert.Contains(t, m.View(), "line-51")
+	assert.Equal(t, 0, m.cursor, "scrolling doesn't change the selected host")
+}
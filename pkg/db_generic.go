@@ -49,6 +49,15 @@ const (
 	StatsBucket   = "bucket:stats"
 
 	StatsKey = "key:stats"
+	// indexedAtKeyPrefix prefixes the key within the StatsBucket holding when a bucket was last (re)indexed.
+	indexedAtKeyPrefix = "key:indexed_at:"
+)
+
+var (
+	// ErrUnknownBucket is returned when a bucket was never created in the db.
+	ErrUnknownBucket = errors.New("bucket is unknown")
+	// ErrItemNotFound is returned when looking up a key which isn't in the bucket.
+	ErrItemNotFound = errors.New("item not found")
 )
 
 type Indexer interface {
@@ -100,7 +109,10 @@ func (d *Db[T]) Open() error {
 
 func (d *Db[T]) Close() error {
 	if d.hdl != nil {
-		return d.hdl.Close()
+		err := d.hdl.Close()
+		// Allows opening it again later on.
+		d.hdl = nil
+		return err
 	}
 	return nil
 }
@@ -147,6 +159,111 @@ func (d *Db[T]) IndexOpaqueItems(ctx context.Context, bucketName string, items [
 	return nil
 }
 
+// ReplaceOpaqueItems replaces everything within the bucket with the items and records when this happened, see
+// IsRecent. Any other bucket in the db is left alone.
+func (d *Db[T]) ReplaceOpaqueItems(ctx context.Context, bucketName string, items []T) error {
+	if d.hdl == nil {
+		return errors.New("trying to index db when handle to db is nil")
+	}
+
+	return d.hdl.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(bucketName)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+
+		bckt, err := tx.CreateBucket([]byte(bucketName))
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if err := d.put(bckt, item.Key(), item); err != nil {
+				return err
+			}
+		}
+
+		stats, err := tx.CreateBucketIfNotExists([]byte(StatsBucket))
+		if err != nil {
+			return err
+		}
+
+		indexedAt, err := time.Now().MarshalText()
+		if err != nil {
+			return err
+		}
+		return stats.Put([]byte(indexedAtKeyPrefix+bucketName), indexedAt)
+	})
+}
+
+// IsRecent reports whether the bucket was replaced within the cache timeout. Unlike Exists it's not fooled by writes
+// to other buckets of the same db file.
+func (d *Db[T]) IsRecent(ctx context.Context, bucketName string) (bool, error) {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	if d.hdl == nil {
+		return false, errors.New("trying to read db when handle to db is nil")
+	}
+
+	var indexedAt time.Time
+	err := d.hdl.View(func(tx *bolt.Tx) error {
+		stats := tx.Bucket([]byte(StatsBucket))
+		if stats == nil {
+			return nil
+		}
+
+		v := stats.Get([]byte(indexedAtKeyPrefix + bucketName))
+		if v == nil {
+			return nil
+		}
+		return indexedAt.UnmarshalText(v)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return !indexedAt.IsZero() && time.Since(indexedAt) <= cfg.CacheTimeout, nil
+}
+
+// DeleteOpaqueItems deletes the items by their keys, keys which aren't in the bucket are simply skipped.
+func (d *Db[T]) DeleteOpaqueItems(ctx context.Context, bucketName string, keys []string) error {
+	return d.deleteFromBucket(bucketName, func(b *bolt.Bucket) error {
+		for _, key := range keys {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeletePrefixedOpaqueItems deletes every item whose key starts with the prefix.
+func (d *Db[T]) DeletePrefixedOpaqueItems(ctx context.Context, bucketName, prefix string) error {
+	return d.deleteFromBucket(bucketName, func(b *bolt.Bucket) error {
+		c := b.Cursor()
+		// Seeks anew after every delete, as a bolt cursor may skip keys when deleting while iterating.
+		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Seek([]byte(prefix)) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *Db[T]) deleteFromBucket(bucketName string, fn func(b *bolt.Bucket) error) error {
+	if d.hdl == nil {
+		return errors.New("trying to delete from db when handle to db is nil")
+	}
+
+	return d.hdl.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			// Nothing to delete.
+			return nil
+		}
+		return fn(b)
+	})
+}
+
 type DBQuery struct {
 	PrefixFilters *prefixcomp.PrimaryFilterAST
 	PrimaryKeys   []string
@@ -156,6 +273,9 @@ func (d *Db[T]) LookupOpaqueItem(ctx context.Context, bucketName, primaryKey str
 	var item *T
 	err := d.hdl.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownBucket, bucketName)
+		}
 
 		i, err := d.lookupOpaqueItem(b, primaryKey)
 		if err != nil {
@@ -195,7 +315,7 @@ func (d *Db[T]) SearchOpaqueItems(ctx context.Context, bucketName string, query
 	if err := d.hdl.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 		if b == nil {
-			return errors.New("bucket is unknown: " + bucketName)
+			return fmt.Errorf("%w: %s", ErrUnknownBucket, bucketName)
 		}
 
 		// Search by primary keys, this a direct lookup, the fastest.
@@ -256,6 +376,9 @@ func (d *Db[T]) put(bucket *bolt.Bucket, key string, data T) error {
 func (d *Db[T]) get(bucket *bolt.Bucket, key string) (T, error) {
 	var obj T
 	v := bucket.Get([]byte(key))
+	if v == nil {
+		return obj, fmt.Errorf("%w: %s", ErrItemNotFound, key)
+	}
 	err := json.Unmarshal(v, &obj)
 	return obj, err
 }
@@ -0,0 +1,238 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/deckarep/tips/pkg/tailscale_cli"
+	"github.com/deckarep/tips/pkg/utils"
+)
+
+const (
+	// cmdWaitDelay is how long a stopped process gets before it's killed and its output pipes are forcibly closed.
+	cmdWaitDelay = time.Second * 5
+)
+
+const (
+	ExecutorAuto      = "auto"
+	ExecutorSSH       = "ssh"
+	ExecutorTailscale = "tailscale"
+	ExecutorNative    = "native"
+)
+
+// ExecRequest describes a single command to be run on a remote host.
+type ExecRequest struct {
+	// Cmd is the remote command, when empty an interactive login shell is started instead.
+	Cmd string
+	// Tty forces a terminal to be allocated remotely, so that signals propagate to the remote process. A Tty must not
+	// be requested when Stdin carries binary data.
+	Tty    bool
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Tags are the tags of the target device, they select any per-tag ssh settings.
+	Tags []string
+}
+
+// RemoteExecutor runs commands on remote hosts, it's what the cluster runner drives for every host.
+type RemoteExecutor interface {
+	// Name identifies the backend, such as: ssh, tailscale or native.
+	Name() string
+	// Exec runs the request on the host and blocks until it completes. It returns the remote exit code, or -1 when
+	// it's unknown, along with an error whenever the command did not succeed, including a non-zero exit code.
+	Exec(ctx context.Context, host string, req *ExecRequest) (int, error)
+	// Describe returns the invocation Exec would make for the request, without making it.
+	Describe(host string, req *ExecRequest) string
+}
+
+// NewRemoteExecutor returns the executor backend selected by the config.
+func NewRemoteExecutor(ctx context.Context) (RemoteExecutor, error) {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+
+	switch strings.ToLower(strings.TrimSpace(cfg.Executor)) {
+	case "", ExecutorAuto:
+		// The ssh binary is preferred as it works with any host. Without one, there's still the Tailscale cli.
+		if binPath, err := sshBinaryPath(cfg.SSHSettings); err == nil {
+			return NewSSHExecutor(binPath, cfg.SSHSettings), nil
+		}
+		if binPath, err := tailscale_cli.BinaryPath(); err == nil {
+			return NewTailscaleSSHExecutor(binPath, cfg.SSHSettings), nil
+		}
+		return nil, errors.New("neither an ssh binary nor the Tailscale cli was found, set \"binary\" of " +
+			"\"ssh_settings\" or \"tailscale_binary\" in the config file or use --executor native")
+	case ExecutorSSH:
+		binPath, err := sshBinaryPath(cfg.SSHSettings)
+		if err != nil {
+			return nil, err
+		}
+		return NewSSHExecutor(binPath, cfg.SSHSettings), nil
+	case ExecutorTailscale:
+		binPath, err := tailscale_cli.BinaryPath()
+		if err != nil {
+			return nil, err
+		}
+		return NewTailscaleSSHExecutor(binPath, cfg.SSHSettings), nil
+	case ExecutorNative:
+		return NewNativeSSHExecutor(nativeSSHConfigFor(cfg.SSHSettings))
+	default:
+		return nil, fmt.Errorf("unknown executor: %q, expected one of: %s, %s, %s or %s",
+			cfg.Executor, ExecutorAuto, ExecutorSSH, ExecutorTailscale, ExecutorNative)
+	}
+}
+
+// sshBinaryPath returns the ssh binary configured in the settings, or else the one found on the PATH.
+func sshBinaryPath(settings SSHSettings) (string, error) {
+	if len(settings.Binary) > 0 {
+		binPath, err := exec.LookPath(expandHome(settings.Binary))
+		if err != nil {
+			return "", fmt.Errorf("the ssh binary configured in ssh_settings is not usable: %w", err)
+		}
+		return binPath, nil
+	}
+
+	binPath, err := exec.LookPath("ssh")
+	if err != nil {
+		return "", fmt.Errorf("no ssh binary found on the PATH, set \"binary\" of \"ssh_settings\" in the config file: %w", err)
+	}
+	return binPath, nil
+}
+
+// CmdExecutor runs remote commands by forking an ssh-like binary for every host, such as the system ssh binary or
+// the ssh subcommand of the Tailscale cli.
+type CmdExecutor struct {
+	name    string
+	binPath string
+	// preArgs go before the host, such as the "ssh" subcommand of the Tailscale cli.
+	preArgs  []string
+	settings SSHSettings
+	// sshFlags tells whether the binary takes the ssh option flags, otherwise only the user is passed as user@host.
+	sshFlags bool
+}
+
+// NewSSHExecutor returns an executor for the ssh binary at binPath, passing along the options of the settings.
+func NewSSHExecutor(binPath string, settings SSHSettings) *CmdExecutor {
+	return &CmdExecutor{name: ExecutorSSH, binPath: binPath, settings: settings, sshFlags: true}
+}
+
+// NewTailscaleSSHExecutor returns an executor which uses `tailscale ssh` of the Tailscale cli at binPath. It doesn't
+// take any ssh option flags, so of the settings only the user applies.
+func NewTailscaleSSHExecutor(binPath string, settings SSHSettings) *CmdExecutor {
+	return &CmdExecutor{name: ExecutorTailscale, binPath: binPath, preArgs: []string{"ssh"}, settings: settings}
+}
+
+func (c *CmdExecutor) Name() string {
+	return c.name
+}
+
+// Args returns the arguments the binary is invoked with for the request.
+func (c *CmdExecutor) Args(host string, req *ExecRequest) []string {
+	opts := c.settings.ForTags(req.Tags)
+
+	args := append([]string{}, c.preArgs...)
+	if c.sshFlags {
+		args = append(args, c.settings.sshArgs(opts)...)
+	} else if len(opts.User) > 0 {
+		host = opts.User + "@" + host
+	}
+	args = append(args, host)
+	if req.Tty {
+		// The double -t indicate we want to force ssh to use a terminal session (forced) this way
+		// it can propagate signals to the child process correctly and shut them down upon early
+		// termination. YOLO!
+		args = append(args, "-t", "-t")
+	}
+	if len(req.Cmd) == 0 {
+		// No command means an interactive login shell.
+		return args
+	}
+	return append(args, req.Cmd)
+}
+
+// CommandLine returns the full command line, binary included, that runs the request on the host.
+func (c *CmdExecutor) CommandLine(host string, req *ExecRequest) []string {
+	return append([]string{c.binPath}, c.Args(host, req)...)
+}
+
+// Describe returns the command line, shell quoted, of the binary invoked for the request.
+func (c *CmdExecutor) Describe(host string, req *ExecRequest) string {
+	var quoted []string
+	for _, arg := range c.CommandLine(host, req) {
+		quoted = append(quoted, utils.ShellQuoteIfNeeded(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (c *CmdExecutor) Exec(ctx context.Context, host string, req *ExecRequest) (int, error) {
+	// Once the context ends the ssh process is stopped, which tears down the remote session along with it.
+	sshCmd := exec.CommandContext(ctx, c.binPath, c.Args(host, req)...)
+	sshCmd.Stdin = req.Stdin
+	sshCmd.Stdout = req.Stdout
+	sshCmd.Stderr = req.Stderr
+	// An interrupted run asks ssh nicely to stop, anything else such as a timeout kills it right away.
+	sshCmd.Cancel = func() error {
+		if interrupted(ctx) {
+			return sshCmd.Process.Signal(os.Interrupt)
+		}
+		return sshCmd.Process.Kill()
+	}
+	// Don't wait forever on output pipes held open by any lingering children, or on an ssh process ignoring the
+	// interrupt.
+	sshCmd.WaitDelay = cmdWaitDelay
+
+	if err := sshCmd.Start(); err != nil {
+		return -1, err
+	}
+
+	// Should the run be interrupted a second time, there's no more waiting around.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-forceKilled(ctx):
+			_ = sshCmd.Process.Kill()
+		case <-done:
+		}
+	}()
+
+	err := sshCmd.Wait()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), err
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
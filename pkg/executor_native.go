@@ -0,0 +1,286 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deckarep/tips/pkg/utils"
+
+	"github.com/charmbracelet/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+// NativeSSHConfig configures the in-process ssh client.
+type NativeSSHConfig struct {
+	User string
+	Port int
+	// KeyFiles are private keys to authenticate with, missing or passphrase protected keys are skipped. The ssh agent
+	// is always tried first when SSH_AUTH_SOCK is set.
+	KeyFiles       []string
+	KnownHostsFile string
+	DialTimeout    time.Duration
+	// Tags overrides the user and port for hosts carrying the tag, see SSHSettings.Tags.
+	Tags map[string]SSHOptions
+}
+
+// DefaultNativeSSHConfig mirrors the defaults of the ssh binary: the current user, port 22 and the usual key files
+// and known_hosts file found in ~/.ssh.
+func DefaultNativeSSHConfig() NativeSSHConfig {
+	cfg := NativeSSHConfig{
+		Port:        22,
+		DialTimeout: time.Second * 10,
+	}
+
+	if u, err := user.Current(); err == nil {
+		cfg.User = u.Username
+		sshDir := filepath.Join(u.HomeDir, ".ssh")
+		cfg.KnownHostsFile = filepath.Join(sshDir, "known_hosts")
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			cfg.KeyFiles = append(cfg.KeyFiles, filepath.Join(sshDir, name))
+		}
+	}
+
+	return cfg
+}
+
+// nativeSSHConfigFor applies the settings over the defaults. Only the user, port and identity file carry over, as
+// there's no ssh binary to take -o options. Per-tag identity files are not supported, as authentication is resolved
+// once up-front.
+func nativeSSHConfigFor(settings SSHSettings) NativeSSHConfig {
+	cfg := DefaultNativeSSHConfig()
+	if len(settings.User) > 0 {
+		cfg.User = settings.User
+	}
+	if settings.Port > 0 {
+		cfg.Port = settings.Port
+	}
+	if len(settings.IdentityFile) > 0 {
+		cfg.KeyFiles = append([]string{expandHome(settings.IdentityFile)}, cfg.KeyFiles...)
+	}
+	cfg.Tags = settings.Tags
+	return cfg
+}
+
+// target returns the user and port to connect with for the request, honoring any per-tag overrides.
+func (n *NativeSSHExecutor) target(req *ExecRequest) (string, int) {
+	opts := SSHSettings{SSHOptions: SSHOptions{User: n.cfg.User, Port: n.cfg.Port}, Tags: n.cfg.Tags}.ForTags(req.Tags)
+	return opts.User, opts.Port
+}
+
+// NativeSSHExecutor runs remote commands with an in-process ssh client. Unlike the binary based executors it never
+// forks a process per host, which matters on large fan-outs, and it always knows the real remote exit status.
+type NativeSSHExecutor struct {
+	cfg             NativeSSHConfig
+	auth            []ssh.AuthMethod
+	hostKeyCallback ssh.HostKeyCallback
+}
+
+// NewNativeSSHExecutor resolves the authentication methods and known hosts up-front, so that a misconfiguration is
+// reported once rather than once per host.
+func NewNativeSSHExecutor(cfg NativeSSHConfig) (*NativeSSHExecutor, error) {
+	var auth []ssh.AuthMethod
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); len(sock) > 0 {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		} else {
+			log.Debug("unable to connect to the ssh agent", "error", err)
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, keyFile := range cfg.KeyFiles {
+		pemBytes, err := os.ReadFile(keyFile)
+		if err != nil {
+			continue
+		}
+
+		signer, err := ssh.ParsePrivateKey(pemBytes)
+		if err != nil {
+			log.Debug("skipping unusable ssh key file", "file", keyFile, "error", err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+
+	if len(auth) == 0 {
+		return nil, errors.New("native ssh executor requires a running ssh agent or an unencrypted key file")
+	}
+
+	// Host keys are always verified.
+	hostKeyCallback, err := knownhosts.New(cfg.KnownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NativeSSHExecutor{
+		cfg:             cfg,
+		auth:            auth,
+		hostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+func (n *NativeSSHExecutor) Name() string {
+	return ExecutorNative
+}
+
+// Describe returns the equivalent ssh invocation, as no binary is involved.
+func (n *NativeSSHExecutor) Describe(host string, req *ExecRequest) string {
+	user, port := n.target(req)
+	args := []string{"ssh", "-p", strconv.Itoa(port), utils.ShellQuoteIfNeeded(user + "@" + host)}
+	if req.Tty {
+		args = append(args, "-t")
+	}
+	if len(req.Cmd) > 0 {
+		args = append(args, utils.ShellQuoteIfNeeded(req.Cmd))
+	}
+	return "(native) " + strings.Join(args, " ")
+}
+
+func (n *NativeSSHExecutor) Exec(ctx context.Context, host string, req *ExecRequest) (int, error) {
+	user, port := n.target(req)
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	dialer := net.Dialer{Timeout: n.cfg.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return -1, err
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            n.auth,
+		HostKeyCallback: n.hostKeyCallback,
+		Timeout:         n.cfg.DialTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		return -1, err
+	}
+
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+
+	// Without a command this is an interactive session, the local terminal drives the remote shell.
+	interactive := len(req.Cmd) == 0
+
+	if req.Tty {
+		width, height := 80, 40
+		modes := ssh.TerminalModes{ssh.ECHO: 0}
+
+		if f, ok := req.Stdin.(*os.File); ok && interactive && term.IsTerminal(int(f.Fd())) {
+			fd := int(f.Fd())
+			if w, h, err := term.GetSize(fd); err == nil {
+				width, height = w, h
+			}
+
+			// Keystrokes, including ctrl-c, must pass through to the remote shell untouched.
+			oldState, err := term.MakeRaw(fd)
+			if err != nil {
+				return -1, err
+			}
+			defer term.Restore(fd, oldState)
+
+			modes = ssh.TerminalModes{ssh.ECHO: 1}
+		}
+
+		if err := session.RequestPty(termType(), height, width, modes); err != nil {
+			return -1, err
+		}
+	}
+
+	session.Stdin = req.Stdin
+	session.Stdout = req.Stdout
+	session.Stderr = req.Stderr
+
+	// Tear the connection down should the context end before the command does.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = session.Signal(ssh.SIGINT)
+
+			// An interrupted run gives the remote command a moment to wind down, unless interrupted again.
+			if interrupted(ctx) {
+				select {
+				case <-done:
+					return
+				case <-forceKilled(ctx):
+				case <-time.After(cmdWaitDelay):
+				}
+			}
+			client.Close()
+		case <-done:
+		}
+	}()
+
+	if interactive {
+		if err = session.Shell(); err == nil {
+			err = session.Wait()
+		}
+	} else {
+		err = session.Run(req.Cmd)
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), err
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// termType returns the terminal type requested for the remote pty, which follows the local one when known.
+func termType() string {
+	if t := os.Getenv("TERM"); len(t) > 0 {
+		return t
+	}
+	return "xterm"
+}
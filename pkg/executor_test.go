@@ -0,0 +1,264 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestCmdExecutorArgs(t *testing.T) {
+	sshExec := NewSSHExecutor("/usr/bin/ssh", SSHSettings{})
+	assert.Equal(t, ExecutorSSH, sshExec.Name())
+	assert.Equal(t, []string{"blade", "-t", "-t", "uptime"}, sshExec.Args("blade", &ExecRequest{Cmd: "uptime", Tty: true}))
+	assert.Equal(t, []string{"blade", "cat"}, sshExec.Args("blade", &ExecRequest{Cmd: "cat"}))
+
+	tsExec := NewTailscaleSSHExecutor("/usr/bin/tailscale", SSHSettings{})
+	assert.Equal(t, ExecutorTailscale, tsExec.Name())
+	assert.Equal(t, []string{"ssh", "blade", "-t", "-t", "uptime"}, tsExec.Args("blade", &ExecRequest{Cmd: "uptime", Tty: true}))
+
+	// Without a command it's an interactive login shell.
+	assert.Equal(t, []string{"ssh", "blade", "-t", "-t"}, tsExec.Args("blade", &ExecRequest{Tty: true}))
+}
+
+func TestCmdExecutorArgsWithSettings(t *testing.T) {
+	settings := SSHSettings{
+		SSHOptions:    SSHOptions{User: "ops", IdentityFile: "~/.ssh/ops", Options: []string{"ServerAliveInterval=15"}},
+		ControlMaster: true,
+		Tags:          map[string]SSHOptions{"db": {User: "postgres", Port: 2222}},
+	}
+
+	sshExec := NewSSHExecutor("/usr/bin/ssh", settings)
+	assert.Equal(t, []string{"-l", "ops", "-i", "~/.ssh/ops",
+		"-o", "ControlMaster=auto", "-o", "ControlPath=~/.ssh/tips-%C", "-o", "ControlPersist=60s",
+		"-o", "ServerAliveInterval=15", "blade", "uptime"}, sshExec.Args("blade", &ExecRequest{Cmd: "uptime"}))
+
+	// A tagged host picks up its overrides.
+	args := sshExec.Args("blade", &ExecRequest{Cmd: "uptime", Tags: []string{"tag:db"}})
+	assert.Equal(t, []string{"-l", "postgres", "-p", "2222"}, args[:4])
+
+	// The Tailscale cli takes no ssh flags, only the user.
+	tsExec := NewTailscaleSSHExecutor("/usr/bin/tailscale", settings)
+	assert.Equal(t, []string{"ssh", "postgres@blade", "uptime"},
+		tsExec.Args("blade", &ExecRequest{Cmd: "uptime", Tags: []string{"tag:db"}}))
+}
+
+func TestCmdExecutorCommandLine(t *testing.T) {
+	tsExec := NewTailscaleSSHExecutor("/usr/bin/tailscale", SSHSettings{})
+	assert.Equal(t, []string{"/usr/bin/tailscale", "ssh", "blade", "-t", "-t"},
+		tsExec.CommandLine("blade", &ExecRequest{Tty: true}))
+
+	sshExec := NewSSHExecutor("/usr/bin/ssh", SSHSettings{})
+	assert.Equal(t, `/usr/bin/ssh blade -t -t 'echo "it'\''s"'`,
+		sshExec.Describe("blade", &ExecRequest{Cmd: `echo "it's"`, Tty: true}))
+}
+
+func TestNewRemoteExecutorUnknown(t *testing.T) {
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Executor = "carrier-pigeon"
+	ctx := context.WithValue(context.Background(), CtxKeyConfig, cfgCtx)
+
+	_, err := NewRemoteExecutor(ctx)
+	assert.Error(t, err)
+
+	// A configured binary which doesn't exist is an error rather than silently falling back.
+	cfgCtx.Executor = ExecutorSSH
+	cfgCtx.SSHSettings.Binary = "/nothing/here/ssh"
+	_, err = NewRemoteExecutor(ctx)
+	assert.ErrorContains(t, err, "ssh_settings")
+}
+
+// startTestSSHServer runs a minimal ssh server on localhost which answers every exec request with its command echoed
+// back, and an exit status of 3 when the command is "fail". A shell request is answered as the command "<shell>". It returns the port and the server's public key.
+func startTestSSHServer(t *testing.T, clientKey ssh.PublicKey) (int, ssh.PublicKey) {
+	t.Helper()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	assert.NoError(t, err)
+
+	serverCfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown public key")
+		},
+	}
+	serverCfg.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(conn, serverCfg)
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port, hostSigner.PublicKey()
+}
+
+func serveTestSSHConn(conn net.Conn, serverCfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverCfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+
+		for req := range chReqs {
+			var cmd string
+			switch req.Type {
+			case "exec":
+				// The payload is a length prefixed string.
+				cmd = string(req.Payload[4:])
+			case "shell":
+				cmd = "<shell>"
+			default:
+				_ = req.Reply(true, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+
+			fmt.Fprintf(ch, "ran: %s\n", cmd)
+			fmt.Fprintf(ch.Stderr(), "on stderr\n")
+
+			var status uint32
+			if cmd == "fail" {
+				status = 3
+			}
+			payload := make([]byte, 4)
+			binary.BigEndian.PutUint32(payload, status)
+			_, _ = ch.SendRequest("exit-status", false, payload)
+			ch.Close()
+			break
+		}
+	}
+}
+
+func TestNativeSSHExecutor(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	sshClientPub, err := ssh.NewPublicKey(clientPub)
+	assert.NoError(t, err)
+
+	port, hostPub := startTestSSHServer(t, sshClientPub)
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "id_ed25519")
+	pemBlock, err := ssh.MarshalPrivateKey(clientPriv, "")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(pemBlock), 0600))
+
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize("127.0.0.1:" + strconv.Itoa(port))}, hostPub)
+	assert.NoError(t, os.WriteFile(knownHostsFile, []byte(line+"\n"), 0600))
+
+	executor, err := NewNativeSSHExecutor(NativeSSHConfig{
+		User:           "tester",
+		Port:           port,
+		KeyFiles:       []string{filepath.Join(dir, "missing"), keyFile},
+		KnownHostsFile: knownHostsFile,
+		DialTimeout:    time.Second * 5,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ExecutorNative, executor.Name())
+
+	var stdout, stderr bytes.Buffer
+	exitCode, err := executor.Exec(context.Background(), "127.0.0.1",
+		&ExecRequest{Cmd: "hostname", Tty: true, Stdout: &stdout, Stderr: &stderr})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "ran: hostname\n", stdout.String())
+	assert.Equal(t, "on stderr\n", stderr.String())
+
+	// The real remote exit status comes back.
+	stdout.Reset()
+	exitCode, err = executor.Exec(context.Background(), "127.0.0.1",
+		&ExecRequest{Cmd: "fail", Stdout: &stdout, Stderr: &stderr})
+	assert.Error(t, err)
+	assert.Equal(t, 3, exitCode)
+
+	// Without a command an interactive shell is started instead.
+	stdout.Reset()
+	exitCode, err = executor.Exec(context.Background(), "127.0.0.1",
+		&ExecRequest{Tty: true, Stdin: strings.NewReader(""), Stdout: &stdout, Stderr: &stderr})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "ran: <shell>\n", stdout.String())
+
+	// An unknown host key is always refused.
+	assert.NoError(t, os.WriteFile(knownHostsFile, nil, 0600))
+	executor, err = NewNativeSSHExecutor(NativeSSHConfig{
+		User:           "tester",
+		Port:           port,
+		KeyFiles:       []string{keyFile},
+		KnownHostsFile: knownHostsFile,
+		DialTimeout:    time.Second * 5,
+	})
+	assert.NoError(t, err)
+	exitCode, err = executor.Exec(context.Background(), "127.0.0.1", &ExecRequest{Cmd: "hostname", Stdout: &stdout})
+	assert.Error(t, err)
+	assert.Equal(t, -1, exitCode)
+}
+
+func TestNewNativeSSHExecutorWithoutAuth(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	_, err := NewNativeSSHExecutor(NativeSSHConfig{KeyFiles: []string{filepath.Join(t.TempDir(), "missing")}})
+	assert.Error(t, err)
+}
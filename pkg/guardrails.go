@@ -0,0 +1,154 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/deckarep/tips/pkg/ui"
+)
+
+const (
+	// guardrailSampleSize is how many hosts are shown when asking for confirmation.
+	guardrailSampleSize = 10
+)
+
+var (
+	// ErrNotConfirmed is returned when a guarded run was not confirmed.
+	ErrNotConfirmed = errors.New("the run was not confirmed, nothing was executed")
+	// ErrConfirmationRequired is returned when a guarded run needs confirming but there's nobody to ask.
+	ErrConfirmationRequired = errors.New("this run requires confirmation but stdin is not interactive, pass --yes to proceed")
+)
+
+// ConfirmRun enforces the guardrail policies of the config before anything runs on the hosts. A run needs confirming
+// when it targets more hosts than the confirm_threshold or any host carrying one of the protected_tags. The target
+// count and a sample of hosts are then rendered to w and an explicit yes is read from r, a nil r meaning there's no
+// one to ask. The --yes flag, or a dry run, skips the confirmation altogether.
+func ConfirmRun(ctx context.Context, r io.Reader, w io.Writer, hosts []RemoteCmdHost, desc string) error {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+
+	if cfg.Yes || cfg.DryRun {
+		return nil
+	}
+
+	reasons, protected := guardrailReasons(cfg, hosts)
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "%s %s on %s host(s) %s\n",
+		ui.Styles.Yellow.Render("About to run"),
+		ui.Styles.Bold.Render(desc),
+		ui.Styles.Bold.Render(fmt.Sprintf("%d", len(hosts))),
+		ui.Styles.Faint.Render("("+strings.Join(reasons, ", ")+")"))
+
+	// Protected hosts are the ones that matter most, so they're shown first.
+	var names []string
+	for _, h := range protected {
+		names = append(names, hostDisplayName(h)+" "+ui.Styles.Red.Render("(protected)"))
+	}
+	for _, h := range hosts {
+		if len(names) >= guardrailSampleSize {
+			break
+		}
+		if !isProtected(cfg, h) {
+			names = append(names, hostDisplayName(h))
+		}
+	}
+	if len(names) > guardrailSampleSize {
+		names = names[:guardrailSampleSize]
+	}
+	for _, name := range names {
+		fmt.Fprintln(w, "  "+name)
+	}
+	if rest := len(hosts) - len(names); rest > 0 {
+		fmt.Fprintln(w, ui.Styles.Faint.Render(fmt.Sprintf("  ... and %d more", rest)))
+	}
+
+	if r == nil {
+		return ErrConfirmationRequired
+	}
+
+	fmt.Fprint(w, ui.Styles.Bold.Render("Type yes to continue: "))
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		fmt.Fprintln(w)
+		return ErrNotConfirmed
+	}
+
+	switch strings.ToLower(strings.TrimSpace(scanner.Text())) {
+	case "y", "yes":
+		return nil
+	default:
+		return ErrNotConfirmed
+	}
+}
+
+// guardrailReasons returns why the run needs confirming, if at all, along with any protected hosts.
+func guardrailReasons(cfg *ConfigCtx, hosts []RemoteCmdHost) ([]string, []RemoteCmdHost) {
+	var (
+		reasons   []string
+		protected []RemoteCmdHost
+	)
+
+	if cfg.ConfirmThreshold > 0 && len(hosts) > cfg.ConfirmThreshold {
+		reasons = append(reasons, fmt.Sprintf("more than the confirm_threshold of %d", cfg.ConfirmThreshold))
+	}
+
+	for _, h := range hosts {
+		if isProtected(cfg, h) {
+			protected = append(protected, h)
+		}
+	}
+	if len(protected) > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d carry a protected tag", len(protected)))
+	}
+
+	return reasons, protected
+}
+
+// isProtected reports whether the device of the host carries any of the protected tags. Protected tags may be given
+// with or without their tag: prefix.
+func isProtected(cfg *ConfigCtx, host RemoteCmdHost) bool {
+	if host.Device == nil {
+		return false
+	}
+
+	for _, protectedTag := range cfg.ProtectedTags {
+		protectedTag = strings.TrimPrefix(strings.TrimSpace(protectedTag), "tag:")
+		for _, tag := range host.Device.Tags {
+			if strings.TrimPrefix(tag, "tag:") == protectedTag {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestConfirmRun(t *testing.T) {
+	var hosts []RemoteCmdHost
+	for i := 0; i < 15; i++ {
+		hosts = append(hosts, RemoteCmdHost{Original: fmt.Sprintf("blade-%02d", i), Device: &WrappedDevice{}})
+	}
+	hosts[12].Device = &WrappedDevice{Device: tailscale.Device{Tags: []string{"tag:web", "tag:prod"}}}
+
+	newCtx := func(modify func(cfg *ConfigCtx)) context.Context {
+		cfgCtx := NewConfigCtx()
+		modify(cfgCtx)
+		return context.WithValue(context.Background(), CtxKeyConfig, cfgCtx)
+	}
+
+	var w bytes.Buffer
+
+	// Without any policy nothing needs confirming.
+	ctx := newCtx(func(cfg *ConfigCtx) {})
+	assert.NoError(t, ConfirmRun(ctx, nil, &w, hosts, "remote command: uptime"))
+	assert.Empty(t, w.String())
+
+	// Under the threshold nothing needs confirming either.
+	ctx = newCtx(func(cfg *ConfigCtx) { cfg.ConfirmThreshold = 15 })
+	assert.NoError(t, ConfirmRun(ctx, nil, &w, hosts, "remote command: uptime"))
+
+	// Over the threshold it does.
+	ctx = newCtx(func(cfg *ConfigCtx) { cfg.ConfirmThreshold = 10 })
+	assert.NoError(t, ConfirmRun(ctx, strings.NewReader("yes\n"), &w, hosts, "remote command: uptime"))
+	out := w.String()
+	assert.Contains(t, out, "About to run remote command: uptime on 15 host(s) (more than the confirm_threshold of 10)")
+	assert.Contains(t, out, "  blade-09\n")
+	assert.NotContains(t, out, "blade-10")
+	assert.Contains(t, out, "  ... and 5 more\n")
+	assert.Contains(t, out, "Type yes to continue: ")
+
+	w.Reset()
+	assert.ErrorIs(t, ConfirmRun(ctx, strings.NewReader("no\n"), &w, hosts, "x"), ErrNotConfirmed)
+	assert.ErrorIs(t, ConfirmRun(ctx, strings.NewReader(""), &w, hosts, "x"), ErrNotConfirmed)
+	assert.ErrorIs(t, ConfirmRun(ctx, nil, &w, hosts, "x"), ErrConfirmationRequired,
+		"there's no one to ask when not interactive")
+
+	// A protected tag, with or without its prefix, always needs confirming and is shown first.
+	for _, protectedTag := range []string{"tag:prod", "prod"} {
+		w.Reset()
+		ctx = newCtx(func(cfg *ConfigCtx) { cfg.ProtectedTags = []string{protectedTag} })
+		assert.ErrorIs(t, ConfirmRun(ctx, nil, &w, hosts, "x"), ErrConfirmationRequired)
+		assert.Contains(t, w.String(), "(1 carry a protected tag)\n  blade-12 (protected)\n  blade-00\n")
+	}
+
+	// Unless --yes was given, or it's merely a dry run.
+	ctx = newCtx(func(cfg *ConfigCtx) { cfg.ProtectedTags = []string{"prod"}; cfg.Yes = true })
+	assert.NoError(t, ConfirmRun(ctx, nil, &w, hosts, "x"))
+	ctx = newCtx(func(cfg *ConfigCtx) { cfg.ProtectedTags = []string{"prod"}; cfg.DryRun = true })
+	assert.NoError(t, ConfirmRun(ctx, nil, &w, hosts, "x"))
+}
@@ -39,10 +39,13 @@ const (
 	MatchNameHostname                  HeaderMatchName = "hostname"
 	MatchNameLastSeen                  HeaderMatchName = "lastseen"
 	MatchNameLastSeenAgo               HeaderMatchName = "lastseen.ago"
+	MatchNameLatency                   HeaderMatchName = "latency"
 	MatchNameMachine                   HeaderMatchName = "machine"
 	MatchNameName                      HeaderMatchName = "name"
 	MatchNameNo                        HeaderMatchName = "no"
 	MatchNameOS                        HeaderMatchName = "os"
+	MatchNamePath                      HeaderMatchName = "path"
+	MatchNameReachable                 HeaderMatchName = "reachable"
 	MatchNameTags                      HeaderMatchName = "tags"
 	MatchNameUser                      HeaderMatchName = "user"
 	MatchNameVersion                   HeaderMatchName = "version"
@@ -51,8 +54,10 @@ const (
 type (
 	Header struct {
 		ReqEnriched bool
-		MatchName   HeaderMatchName
-		Title       string
+		// ReqPing headers are only shown once devices were pinged.
+		ReqPing   bool
+		MatchName HeaderMatchName
+		Title     string
 
 		// TODO: factor in alias names?
 		// Aliases []string
@@ -69,8 +74,11 @@ var (
 	HdrIpv4        = Header{Title: "Ipv4", MatchName: MatchNameIpv4}
 	HdrIpv6        = Header{Title: "Ipv6", MatchName: MatchNameIpv6}
 	HdrLastSeenAgo = Header{Title: "Last Seen", MatchName: MatchNameLastSeenAgo, ReqEnriched: true}
+	HdrLatency     = Header{Title: "Latency", MatchName: MatchNameLatency, ReqPing: true}
 	HdrMachine     = Header{Title: "Machine", MatchName: MatchNameMachine}
 	HdrNo          = Header{Title: "No", MatchName: MatchNameNo}
+	HdrPath        = Header{Title: "Path", MatchName: MatchNamePath, ReqPing: true}
+	HdrReachable   = Header{Title: "Reachable", MatchName: MatchNameReachable, ReqPing: true}
 	HdrTags        = Header{Title: "Tags", MatchName: MatchNameTags}
 	HdrUser        = Header{Title: "User", MatchName: MatchNameUser}
 	HdrVersion     = Header{Title: "Version", MatchName: MatchNameVersion}
@@ -83,8 +91,11 @@ var (
 		HdrIpv4,
 		HdrIpv6,
 		HdrLastSeenAgo,
+		HdrLatency,
 		HdrMachine,
 		HdrNo,
+		HdrPath,
+		HdrReachable,
 		HdrTags,
 		HdrUser,
 		HdrVersion,
@@ -110,5 +121,8 @@ var (
 		HdrVersion,
 		HdrExitStatus,
 		HdrLastSeenAgo,
+		HdrReachable,
+		HdrLatency,
+		HdrPath,
 	}
 )
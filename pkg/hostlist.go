@@ -0,0 +1,163 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hostRun is a run of hostnames sharing the same prefix and suffix around their trailing number.
+type hostRun struct {
+	prefix  string
+	suffix  string
+	width   int
+	numbers []int
+}
+
+// CompactHostnames folds a list of hostnames into a compact host-list in the style of pdsh/dshbak, where hosts
+// differing only by their last number are written as ranges: blade-0001, blade-0002, blade-0003 and peanut-0003
+// becomes blade-[0001-0003],peanut-0003. Zero padding is preserved and duplicates are dropped.
+func CompactHostnames(names []string) string {
+	type numbered struct {
+		prefix, suffix string
+		digits         string
+		n              int
+	}
+
+	var (
+		runs    = make(map[string]*hostRun)
+		plain   = make(map[string]struct{})
+		keys    []string
+		numbers []numbered
+		// padded holds every prefix, suffix and width that was seen zero padded.
+		padded = make(map[string]struct{})
+		runKey = func(num numbered, width int) string {
+			return fmt.Sprintf("%s\x00%s\x00%d", num.prefix, num.suffix, width)
+		}
+	)
+
+	for _, name := range names {
+		prefix, digits, suffix, ok := splitTrailingNumber(name)
+		if !ok {
+			plain[name] = struct{}{}
+			continue
+		}
+
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			// Far too many digits to be a counter, so just treat it as is.
+			plain[name] = struct{}{}
+			continue
+		}
+
+		num := numbered{prefix: prefix, suffix: suffix, digits: digits, n: n}
+		numbers = append(numbers, num)
+		if len(digits) > 1 && digits[0] == '0' {
+			padded[runKey(num, len(digits))] = struct{}{}
+		}
+	}
+
+	for _, num := range numbers {
+		// Only a leading zero makes the width significant, otherwise 9 and 10 belong to the same run. An unpadded
+		// number as wide as padded ones belongs with them though, that's a padded counter rolling over: web09, web10.
+		width := 0
+		if _, ok := padded[runKey(num, len(num.digits))]; ok {
+			width = len(num.digits)
+		}
+		key := runKey(num, width)
+
+		r, ok := runs[key]
+		if !ok {
+			r = &hostRun{prefix: num.prefix, suffix: num.suffix, width: width}
+			runs[key] = r
+			keys = append(keys, key)
+		}
+		r.numbers = append(r.numbers, num.n)
+	}
+
+	var parts []string
+	for name := range plain {
+		parts = append(parts, name)
+	}
+	for _, key := range keys {
+		parts = append(parts, runs[key].String())
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ",")
+}
+
+func (r *hostRun) String() string {
+	sort.Ints(r.numbers)
+
+	var (
+		ranges []string
+		count  int
+	)
+	for i := 0; i < len(r.numbers); {
+		start := r.numbers[i]
+		end := start
+		for i < len(r.numbers) && r.numbers[i] <= end+1 {
+			end = r.numbers[i]
+			i++
+		}
+		count += end - start + 1
+
+		if start == end {
+			ranges = append(ranges, r.format(start))
+		} else {
+			ranges = append(ranges, r.format(start)+"-"+r.format(end))
+		}
+	}
+
+	// A single host needs no brackets.
+	if count == 1 {
+		return r.prefix + ranges[0] + r.suffix
+	}
+	return r.prefix + "[" + strings.Join(ranges, ",") + "]" + r.suffix
+}
+
+func (r *hostRun) format(n int) string {
+	return fmt.Sprintf("%0*d", r.width, n)
+}
+
+// splitTrailingNumber splits a name around its last run of digits, ok is false when it has none.
+func splitTrailingNumber(name string) (prefix, digits, suffix string, ok bool) {
+	end := strings.LastIndexAny(name, "0123456789")
+	if end < 0 {
+		return "", "", "", false
+	}
+
+	start := end
+	for start > 0 && name[start-1] >= '0' && name[start-1] <= '9' {
+		start--
+	}
+
+	return name[:start], name[start : end+1], name[end+1:], true
+}
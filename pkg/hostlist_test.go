@@ -0,0 +1,57 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactHostnames(t *testing.T) {
+	cases := []struct {
+		names    []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"localhost"}, "localhost"},
+		{[]string{"blade-0001"}, "blade-0001"},
+		{[]string{"blade-0003", "blade-0001", "blade-0002"}, "blade-[0001-0003]"},
+		{[]string{"blade-0001", "blade-0002", "blade-0004", "peanut-0003"}, "blade-[0001-0002,0004],peanut-0003"},
+		{[]string{"blade-0001", "blade-0001", "blade-0002"}, "blade-[0001-0002]"},
+		{[]string{"web9", "web10", "web11"}, "web[9-11]"},
+		{[]string{"web09", "web10", "web11"}, "web[09-11]"},
+		{[]string{"web10", "web08", "web09", "web7"}, "web7,web[08-10]"},
+		{[]string{"web099", "web100", "web9", "web10"}, "web[099-100],web[9-10]"},
+		{[]string{"rack1-node1", "rack1-node2", "rack2-node1"}, "rack1-node[1-2],rack2-node1"},
+		{[]string{"db1.east", "db2.east", "db1.west"}, "db1.west,db[1-2].east"},
+		{[]string{"zeta", "alpha", "node-1"}, "alpha,node-1,zeta"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, CompactHostnames(c.names), "unexpected compaction of: %v", c.names)
+	}
+}
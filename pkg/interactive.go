@@ -0,0 +1,103 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/deckarep/tips/pkg/ui"
+
+	"github.com/charmbracelet/log"
+)
+
+// ErrNoHostSelected is returned when the user backs out of picking a host.
+var ErrNoHostSelected = errors.New("no host was selected")
+
+// sshConnectionFailedExitCode is what ssh exits with when it failed itself, such as when the host is unreachable,
+// authentication was refused or the host key doesn't match.
+const sshConnectionFailedExitCode = 255
+
+// StartInteractiveSession opens an interactive login shell on the host via the executor with the local terminal
+// attached, blocking until the session ends.
+func StartInteractiveSession(ctx context.Context, executor RemoteExecutor, host RemoteCmdHost) error {
+	log.Info("starting interactive session", "host", hostDisplayName(host), "executor", executor.Name())
+
+	exitCode, err := executor.Exec(ctx, host.Original, &ExecRequest{
+		Tty:    true,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Tags:   host.Tags(),
+	})
+
+	// Once the session got going a non-zero exit code is merely the status of whatever ran last in the shell. That is
+	// except for ssh's own failures, the ssh binary already explained those on the attached stderr.
+	if exitCode == sshConnectionFailedExitCode {
+		return fmt.Errorf("the session to %s failed with exit code %d", hostDisplayName(host), exitCode)
+	}
+	if exitCode >= 0 {
+		return nil
+	}
+	return err
+}
+
+// PromptHostIndex asks for the index of one of count hosts on w and reads the answer from r, asking again until a
+// valid index is given. An empty answer, or running out of input, returns ErrNoHostSelected.
+func PromptHostIndex(r io.Reader, w io.Writer, count int) (int, error) {
+	scanner := bufio.NewScanner(r)
+
+	for {
+		fmt.Fprint(w, ui.Styles.Bold.Render(fmt.Sprintf("Pick a host by No (0-%d): ", count-1)))
+
+		if !scanner.Scan() {
+			fmt.Fprintln(w)
+			if err := scanner.Err(); err != nil {
+				return -1, err
+			}
+			return -1, ErrNoHostSelected
+		}
+
+		answer := strings.TrimSpace(scanner.Text())
+		if len(answer) == 0 {
+			return -1, ErrNoHostSelected
+		}
+
+		idx, err := strconv.Atoi(answer)
+		if err != nil || idx < 0 || idx >= count {
+			fmt.Fprintln(w, ui.Styles.Red.Render(fmt.Sprintf("%q is not a valid choice", answer)))
+			continue
+		}
+
+		return idx, nil
+	}
+}
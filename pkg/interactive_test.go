@@ -0,0 +1,85 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromptHostIndex(t *testing.T) {
+	var w bytes.Buffer
+
+	idx, err := PromptHostIndex(strings.NewReader("2\n"), &w, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, idx)
+	assert.Contains(t, w.String(), "Pick a host by No (0-2): ")
+
+	// Invalid answers are asked again.
+	w.Reset()
+	idx, err = PromptHostIndex(strings.NewReader("blade\n3\n-1\n 1 \n"), &w, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, idx)
+	assert.Equal(t, 4, strings.Count(w.String(), "Pick a host"))
+	assert.Contains(t, w.String(), `"blade" is not a valid choice`)
+
+	// Backing out with an empty answer or no input at all.
+	_, err = PromptHostIndex(strings.NewReader("\n"), &w, 3)
+	assert.ErrorIs(t, err, ErrNoHostSelected)
+
+	_, err = PromptHostIndex(strings.NewReader(""), &w, 3)
+	assert.ErrorIs(t, err, ErrNoHostSelected)
+}
+
+func TestStartInteractiveSession(t *testing.T) {
+	exitCode := 0
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		if exitCode != 0 {
+			return exitCode, fmt.Errorf("exit status %d", exitCode)
+		}
+		return 0, nil
+	}}
+	host := RemoteCmdHost{Original: "blade-01"}
+
+	assert.NoError(t, StartInteractiveSession(context.Background(), executor, host))
+
+	// Whatever ran last in the shell failing is no failure of the session.
+	exitCode = 1
+	assert.NoError(t, StartInteractiveSession(context.Background(), executor, host))
+
+	// ssh itself failing, such as when the host is unreachable, is.
+	exitCode = 255
+	assert.Error(t, StartInteractiveSession(context.Background(), executor, host))
+
+	// As is not getting as far as an exit code at all.
+	exitCode = -1
+	assert.Error(t, StartInteractiveSession(context.Background(), executor, host))
+}
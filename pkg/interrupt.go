@@ -0,0 +1,125 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// ctxKeyForceKill holds the channel which is closed once running remote commands must be killed outright.
+	ctxKeyForceKill = contextKey("force-kill")
+	// ctxKeyInterrupt holds the func which interrupts the run just like Ctrl-C would.
+	ctxKeyInterrupt = contextKey("interrupt")
+)
+
+// ErrInterrupted is the cause of a run's context being cancelled by an interrupt, such as Ctrl-C.
+var ErrInterrupted = errors.New("interrupted")
+
+// WithInterruptHandler installs the single signal handler of a run. The first SIGINT or SIGTERM cancels the returned
+// context with ErrInterrupted, which asks every remote command to stop gracefully and keeps any new host from being
+// started. A second one force kills whatever is still running. The returned stop func must be called once the run is
+// over, it uninstalls the handler.
+//
+// The returned context also carries an interrupt func, see interruptFunc, for interrupts which don't arrive as a
+// signal, such as the Ctrl-C pressed on the dashboard.
+func WithInterruptHandler(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	force := make(chan struct{})
+	ctx = context.WithValue(ctx, ctxKeyForceKill, (<-chan struct{})(force))
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	// Goes through the very same handling as a signal, it's dropped when two interrupts are pending already.
+	ctx = context.WithValue(ctx, ctxKeyInterrupt, func() {
+		select {
+		case signals <- os.Interrupt:
+		default:
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+
+		// Keeps the warning off the line a ^C was echoed on, unless logging is silenced such as by the dashboard.
+		if log.GetLevel() <= log.WarnLevel {
+			fmt.Fprintln(os.Stderr)
+		}
+		log.Warn("interrupt received, stopping the remote commands... interrupt again to kill them")
+		cancel(ErrInterrupted)
+
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+
+		log.Warn("second interrupt received, killing the remote commands")
+		close(force)
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel(nil)
+	}
+}
+
+// interrupted reports whether the context ended because the run was interrupted.
+func interrupted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrInterrupted)
+}
+
+// forceKilled returns a channel which is closed once running remote commands must be killed outright. Without an
+// interrupt handler it's never closed.
+func forceKilled(ctx context.Context) <-chan struct{} {
+	if ch, ok := ctx.Value(ctxKeyForceKill).(<-chan struct{}); ok {
+		return ch
+	}
+	return nil
+}
+
+// interruptFunc returns the func which interrupts the run just like Ctrl-C would. Without an interrupt handler it does
+// nothing.
+func interruptFunc(ctx context.Context) func() {
+	if fn, ok := ctx.Value(ctxKeyInterrupt).(func()); ok {
+		return fn
+	}
+	return func() {}
+}
@@ -0,0 +1,179 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithInterruptHandler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are posix only")
+	}
+
+	ctx, stop := WithInterruptHandler(context.Background())
+	defer stop()
+
+	assert.False(t, interrupted(ctx))
+
+	interruptSelf()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("the first interrupt should cancel the context")
+	}
+	assert.True(t, interrupted(ctx))
+
+	select {
+	case <-forceKilled(ctx):
+		t.Fatal("the first interrupt must not force kill")
+	default:
+	}
+
+	interruptSelf()
+	select {
+	case <-forceKilled(ctx):
+	case <-time.After(time.Second * 5):
+		t.Fatal("the second interrupt should force kill")
+	}
+}
+
+func TestInterruptFunc(t *testing.T) {
+	ctx, stop := WithInterruptHandler(context.Background())
+	defer stop()
+
+	interruptFunc(ctx)()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("the first interrupt should cancel the context")
+	}
+	assert.True(t, interrupted(ctx))
+
+	interruptFunc(ctx)()
+	select {
+	case <-forceKilled(ctx):
+	case <-time.After(time.Second * 5):
+		t.Fatal("the second interrupt should force kill")
+	}
+}
+
+func TestInterruptedWithoutHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.False(t, interrupted(ctx), "an ordinary cancellation is not an interrupt")
+	assert.Nil(t, forceKilled(ctx))
+	assert.NotPanics(t, interruptFunc(ctx))
+}
+
+func TestExecuteClusterRemoteCmdInterrupted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ssh requires a posix shell")
+	}
+	// Interrupt once both hosts of the first batch are running.
+	var started atomic.Int32
+	executor := &hookedExecutor{RemoteExecutor: newFakeSSH(t), started: func(ctx context.Context) {
+		if started.Add(1) == 2 {
+			interruptFunc(ctx)()
+		}
+	}}
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 2
+	cfgCtx.NoColor = true
+	cfgCtx.Rollout = RolloutStrategy{Batch: BatchSize{Count: 2}}
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{{Original: "a"}, {Original: "b"}, {Original: "c"}}
+
+	var b bytes.Buffer
+	startTime := time.Now()
+	results := ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "exec sleep 30")
+
+	assert.Less(t, time.Since(startTime), time.Second*10, "the interrupt stops the hosts right away")
+	assert.Equal(t, StatusInterrupted, results[0].Status)
+	assert.Equal(t, StatusInterrupted, results[1].Status)
+	assert.Equal(t, StatusSkipped, results[2].Status, "nothing new starts after an interrupt")
+	assert.ErrorIs(t, results[2].Err, ErrInterrupted)
+	assert.Len(t, results.Unsuccessful(), 3)
+	assert.True(t, results.Interrupted())
+	assert.Contains(t, b.String(), "interrupted: 2")
+	assert.Contains(t, b.String(), "Interrupted: a,b\n")
+}
+
+func TestExecuteClusterRemoteCmdInterruptedDuringPause(t *testing.T) {
+	// Interrupt as the only host of the first batch wraps up, so it lands in-between batches with no host running.
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		interruptFunc(ctx)()
+		return 0, nil
+	}}
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 1
+	cfgCtx.Rollout = RolloutStrategy{Batch: BatchSize{Count: 1}, Pause: time.Second * 30}
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{{Original: "a"}, {Original: "b"}}
+
+	var b bytes.Buffer
+	startTime := time.Now()
+	results := ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "whatever")
+
+	assert.Less(t, time.Since(startTime), time.Second*10, "the interrupt cuts the pause short")
+	assert.Equal(t, StatusSucceeded, results[0].Status)
+	assert.Equal(t, StatusSkipped, results[1].Status)
+	assert.Len(t, results.Unsuccessful(), 1, "the run was cut short, so it didn't succeed")
+	assert.True(t, results.Interrupted())
+}
+
+// hookedExecutor calls started whenever a host is about to be executed on, with the context of the run.
+type hookedExecutor struct {
+	RemoteExecutor
+	started func(ctx context.Context)
+}
+
+func (h *hookedExecutor) Exec(ctx context.Context, host string, req *ExecRequest) (int, error) {
+	h.started(ctx)
+	return h.RemoteExecutor.Exec(ctx, host, req)
+}
+
+// interruptSelf interrupts the test process just like Ctrl-C would, which is posix only.
+func interruptSelf() {
+	if self, err := os.FindProcess(os.Getpid()); err == nil {
+		_ = self.Signal(os.Interrupt)
+	}
+}
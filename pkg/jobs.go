@@ -0,0 +1,710 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/deckarep/tips/pkg/prefixcomp"
+	"github.com/deckarep/tips/pkg/ui"
+
+	"github.com/charmbracelet/log"
+	"github.com/dustin/go-humanize"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// JobsBucket holds a record per detached run, it lives in the same db file as the cached devices.
+	JobsBucket = "bucket:jobs"
+	// JobLogsBucket holds every line of output of the detached runs, keyed by job, host and sequence.
+	JobLogsBucket = "bucket:jobs.logs"
+
+	// jobFlushInterval is how often a running job persists its progress.
+	jobFlushInterval = time.Second
+	// jobMaxPendingLines bounds the lines held on to while the db can't be saved to, the oldest ones are dropped.
+	jobMaxPendingLines = 100_000
+	// runnerLogLines is how many of the last lines a detached runner logs are kept with its job.
+	runnerLogLines = 50
+
+	hostStateQueued  = "queued"
+	hostStateRunning = "running"
+)
+
+// JobState is where a detached run is at.
+type JobState string
+
+const (
+	// JobStarting means the job was created, but the detached runner hasn't picked it up yet.
+	JobStarting JobState = "starting"
+	JobRunning  JobState = "running"
+	JobFinished JobState = "finished"
+	// JobLost means the runner went away without finishing the job, such as when it was killed.
+	JobLost JobState = "lost"
+	// JobFailed means the runner bailed out without finishing the job, the job's error says why.
+	JobFailed JobState = "failed"
+)
+
+// Job is the record of a detached run. Each host starts out as queued and ends up with the same status a transcript
+// records for it.
+type Job struct {
+	ID        string              `json:"id"`
+	Desc      string              `json:"desc"`
+	Query     string              `json:"query"`
+	PID       int                 `json:"pid"`
+	State     JobState            `json:"state"`
+	StartTime time.Time           `json:"start"`
+	EndTime   *time.Time          `json:"end,omitempty"`
+	Hosts     []*TranscriptStatus `json:"hosts"`
+	// Error is why the runner bailed out, Log is what it logged along the way as nobody reads its stderr.
+	Error string   `json:"error,omitempty"`
+	Log   []string `json:"log,omitempty"`
+}
+
+// Key orders jobs by when they were started, as the id starts with the time.
+func (j *Job) Key() string {
+	return j.ID
+}
+
+// snapshot copies the job along with its hosts, which the runner keeps updating in place.
+func (j *Job) snapshot() *Job {
+	c := *j
+	c.Hosts = make([]*TranscriptStatus, len(j.Hosts))
+	for i, h := range j.Hosts {
+		hc := *h
+		c.Hosts[i] = &hc
+	}
+	return &c
+}
+
+// Counts tallies the hosts of the job by their status.
+func (j *Job) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, h := range j.Hosts {
+		counts[h.Status]++
+	}
+	return counts
+}
+
+// JobLogLine is a single line of output of a detached run.
+type JobLogLine struct {
+	JobID string `json:"job"`
+	Seq   int    `json:"seq"`
+	TranscriptLine
+}
+
+// Key groups the lines by job, then by host.
+func (l *JobLogLine) Key() string {
+	return fmt.Sprintf("%s/%06d/%08d", l.JobID, l.Idx, l.Seq)
+}
+
+// NewJob creates the record of a detached run over the hosts, every one of them queued.
+func NewJob(desc, query string, hosts []RemoteCmdHost) *Job {
+	return &Job{
+		ID:        fmt.Sprintf("%s-%04x", time.Now().UTC().Format("20060102-150405"), rand.Intn(0x10000)),
+		Desc:      desc,
+		Query:     query,
+		State:     JobStarting,
+		StartTime: time.Now(),
+		Hosts:     queuedHosts(hosts),
+	}
+}
+
+func queuedHosts(hosts []RemoteCmdHost) []*TranscriptStatus {
+	statuses := make([]*TranscriptStatus, 0, len(hosts))
+	for idx, host := range hosts {
+		statuses = append(statuses, &TranscriptStatus{
+			Type:   "status",
+			Idx:    idx,
+			Host:   host.Original,
+			Alias:  host.Alias,
+			Status: hostStateQueued,
+		})
+	}
+	return statuses
+}
+
+// JobStore persists jobs into the tailnet's db file. The db is only ever opened briefly, as bolt locks the whole file
+// while it's open and both the runner and `tips jobs` need at it.
+type JobStore struct {
+	tailnet string
+}
+
+func NewJobStore(tailnet string) *JobStore {
+	return &JobStore{tailnet: tailnet}
+}
+
+// Save writes the job along with any new lines of output. The lines go first, so a finished job always has all of
+// its output.
+func (s *JobStore) Save(ctx context.Context, job *Job, lines []*JobLogLine) error {
+	if len(lines) > 0 {
+		logs := NewDB2[*JobLogLine](s.tailnet)
+		if err := logs.Open(); err != nil {
+			return err
+		}
+		err := logs.IndexOpaqueItems(ctx, JobLogsBucket, lines)
+		if closeErr := logs.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	jobs := NewDB2[*Job](s.tailnet)
+	if err := jobs.Open(); err != nil {
+		return err
+	}
+	err := jobs.IndexOpaqueItems(ctx, JobsBucket, []*Job{job})
+	if closeErr := jobs.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// List returns every job, the most recently started first.
+func (s *JobStore) List(ctx context.Context) ([]*Job, error) {
+	jobs := NewDB2[*Job](s.tailnet)
+	if err := jobs.Open(); err != nil {
+		return nil, err
+	}
+	defer jobs.Close()
+
+	all, err := jobs.SearchOpaqueItems(ctx, JobsBucket, DBQuery{PrefixFilters: &prefixcomp.PrimaryFilterAST{All: true}})
+	if errors.Is(err, ErrUnknownBucket) {
+		// Nothing was ever detached.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].StartTime.After(all[j].StartTime)
+	})
+	for _, job := range all {
+		job.checkRunner()
+	}
+	return all, nil
+}
+
+// Get returns the job with the id.
+func (s *JobStore) Get(ctx context.Context, id string) (*Job, error) {
+	jobs := NewDB2[*Job](s.tailnet)
+	if err := jobs.Open(); err != nil {
+		return nil, err
+	}
+	defer jobs.Close()
+
+	job, err := jobs.LookupOpaqueItem(ctx, JobsBucket, id)
+	if errors.Is(err, ErrUnknownBucket) || errors.Is(err, ErrItemNotFound) {
+		return nil, fmt.Errorf("no job with id: %q, tips jobs list shows them all", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	(*job).checkRunner()
+	return *job, nil
+}
+
+// Logs returns every line of output of the job, in the order the lines arrived.
+func (s *JobStore) Logs(ctx context.Context, id string) ([]*JobLogLine, error) {
+	logs := NewDB2[*JobLogLine](s.tailnet)
+	if err := logs.Open(); err != nil {
+		return nil, err
+	}
+	defer logs.Close()
+
+	lines, err := logs.SearchOpaqueItems(ctx, JobLogsBucket,
+		DBQuery{PrefixFilters: &prefixcomp.PrimaryFilterAST{Words: []string{id + "/"}}})
+	if errors.Is(err, ErrUnknownBucket) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Seq is the order the lines arrived in, timestamps alone are too coarse to tell apart lines of the same tick.
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].Seq < lines[j].Seq
+	})
+	return lines, nil
+}
+
+// Remove deletes the jobs along with all of their output.
+func (s *JobStore) Remove(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	db := NewDB2[*Job](s.tailnet)
+	if err := db.Open(); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, id := range ids {
+		if err := db.DeletePrefixedOpaqueItems(ctx, JobLogsBucket, id+"/"); err != nil {
+			return err
+		}
+	}
+	return db.DeleteOpaqueItems(ctx, JobsBucket, ids)
+}
+
+// Prune removes the jobs which are over for longer than the retention, so their output doesn't pile up in the db
+// forever. A retention of 0 keeps every job.
+func (s *JobStore) Prune(ctx context.Context, retention time.Duration) ([]string, error) {
+	if retention <= 0 {
+		return nil, nil
+	}
+
+	jobs, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []string
+	for _, job := range jobs {
+		if job.Over() && time.Since(job.lastActive()) > retention {
+			expired = append(expired, job.ID)
+		}
+	}
+	return expired, s.Remove(ctx, expired...)
+}
+
+// Over reports whether the job's runner is done with it, one way or another.
+func (j *Job) Over() bool {
+	return j.State == JobFinished || j.State == JobFailed || j.State == JobLost
+}
+
+// lastActive is when the job ended, a lost job never got to record that so it's when it started.
+func (j *Job) lastActive() time.Time {
+	if j.EndTime != nil {
+		return *j.EndTime
+	}
+	return j.StartTime
+}
+
+// RecordRunnerExit records how the runner of the job ended. A job it finished is left be, any other job failed: the
+// runner bailed out before or while running it, so its error along with what it logged is kept to tell why.
+func (s *JobStore) RecordRunnerExit(ctx context.Context, id string, runErr error) error {
+	job, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if job.State == JobFinished {
+		return nil
+	}
+
+	now := time.Now()
+	job.State = JobFailed
+	job.EndTime = &now
+	job.Error = "the runner exited without recording the run into the job"
+	if runErr != nil {
+		job.Error = runErr.Error()
+	}
+	job.Log = detachedRunnerLog.Lines()
+	return s.Save(ctx, job, nil)
+}
+
+// setRunner records the pid of the job's runner, unless the runner already picked up the job by itself. It's a
+// single open of the db, so the runner can't pick up the job in between.
+func (s *JobStore) setRunner(ctx context.Context, id string, pid int) error {
+	jobs := NewDB2[*Job](s.tailnet)
+	if err := jobs.Open(); err != nil {
+		return err
+	}
+	defer jobs.Close()
+
+	job, err := jobs.LookupOpaqueItem(ctx, JobsBucket, id)
+	if err != nil {
+		return err
+	}
+	if (*job).State != JobStarting {
+		return nil
+	}
+
+	(*job).PID = pid
+	return jobs.IndexOpaqueItems(ctx, JobsBucket, []*Job{*job})
+}
+
+// checkRunner marks a job as lost when its runner is no longer around to finish it. A starting job only has a pid
+// once its runner was started.
+func (j *Job) checkRunner() {
+	switch {
+	case j.State == JobRunning && !processAlive(j.PID):
+		j.State = JobLost
+	case j.State == JobStarting && j.PID > 0 && !processAlive(j.PID):
+		j.State = JobLost
+	}
+}
+
+// StartDetachedJob saves the job and starts the runner of it: this very executable invoked with args, in a session
+// of its own, so it carries on after the terminal is closed. The runner's output goes nowhere, it's all in the job.
+func StartDetachedJob(ctx context.Context, job *Job, args []string) error {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	store := NewJobStore(cfg.Tailnet)
+
+	// Every new job makes room by dropping the expired ones.
+	if _, err := store.Prune(ctx, cfg.JobRetention); err != nil {
+		log.Warn("error pruning expired jobs", "error", err)
+	}
+
+	if err := store.Save(ctx, job, nil); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	runner := exec.Command(exe, args...)
+	runner.SysProcAttr = detachedSysProcAttr()
+	if err = runner.Start(); err != nil {
+		return err
+	}
+
+	// With the pid on record, a runner which dies before picking up the job shows up as lost rather than starting.
+	job.PID = runner.Process.Pid
+	if err = store.setRunner(ctx, job.ID, job.PID); err != nil {
+		log.Warn("error recording the runner of the job", "job", job.ID, "error", err)
+	}
+	return runner.Process.Release()
+}
+
+// runnerLog keeps the last lines a detached runner logs.
+type runnerLog struct {
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+}
+
+// detachedRunnerLog is where a detached runner logs to, see CaptureRunnerLog.
+var detachedRunnerLog = &runnerLog{}
+
+// CaptureRunnerLog makes a detached runner keep what it logs, so it's recorded along with its job.
+func CaptureRunnerLog() {
+	log.SetOutput(detachedRunnerLog)
+}
+
+func (l *runnerLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.partial = append(l.partial, p...)
+	for {
+		before, after, found := bytes.Cut(l.partial, []byte("\n"))
+		if !found {
+			break
+		}
+		l.lines = append(l.lines, string(before))
+		l.partial = after
+	}
+
+	if len(l.lines) > runnerLogLines {
+		l.lines = append([]string(nil), l.lines[len(l.lines)-runnerLogLines:]...)
+	}
+	return len(p), nil
+}
+
+// Lines returns the lines logged so far.
+func (l *runnerLog) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]string(nil), l.lines...)
+}
+
+// jobOutput is how a detached runner records its progress into the job, periodically saving it along with the new
+// lines of output.
+type jobOutput struct {
+	store *JobStore
+	stop  chan struct{}
+	done  chan struct{}
+
+	mu      sync.Mutex
+	job     *Job
+	pending []*JobLogLine
+	seq     int
+}
+
+// newJobOutput picks up the job, the hosts this runner selected are the ones which count.
+func newJobOutput(ctx context.Context, jobID string, hosts []RemoteCmdHost) (*jobOutput, error) {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	store := NewJobStore(cfg.Tailnet)
+
+	job, err := store.Get(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	job.PID = os.Getpid()
+	job.State = JobRunning
+	job.Hosts = queuedHosts(hosts)
+
+	o := &jobOutput{
+		store: store,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		job:   job,
+	}
+	if err = store.Save(ctx, job, nil); err != nil {
+		return nil, err
+	}
+
+	go o.flushLoop(ctx)
+	return o, nil
+}
+
+func (o *jobOutput) flushLoop(ctx context.Context) {
+	defer close(o.done)
+
+	ticker := time.NewTicker(jobFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			o.flush(ctx)
+		case <-o.stop:
+			return
+		}
+	}
+}
+
+func (o *jobOutput) flush(ctx context.Context) {
+	// Saving may wait on the db's file lock, so it happens on a snapshot and never holds up the output of the hosts.
+	o.mu.Lock()
+	job := o.job.snapshot()
+	pending := o.pending
+	o.pending = nil
+	o.mu.Unlock()
+
+	if err := o.store.Save(ctx, job, pending); err != nil {
+		log.Error("error saving the job", "job", job.ID, "error", err)
+
+		// Should the db be busy, the lines are simply saved on the next go.
+		o.mu.Lock()
+		o.pending = append(pending, o.pending...)
+		if dropped := len(o.pending) - jobMaxPendingLines; dropped > 0 {
+			log.Warn("the job can't keep up saving its output, dropping the oldest lines", "job", job.ID,
+				"dropped", dropped)
+			o.pending = o.pending[dropped:]
+		}
+		o.mu.Unlock()
+	}
+}
+
+func (o *jobOutput) hostStarted(ctx context.Context, idx int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	o.job.Hosts[idx].Status = hostStateRunning
+	o.job.Hosts[idx].StartTime = &now
+}
+
+func (o *jobOutput) line(ctx context.Context, hl hostLine) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.seq++
+	o.pending = append(o.pending, &JobLogLine{JobID: o.job.ID, Seq: o.seq, TranscriptLine: *newTranscriptLine(hl)})
+}
+
+func (o *jobOutput) hostDone(ctx context.Context, res *RemoteCmdResult) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.job.Hosts[res.Idx] = newTranscriptStatus(res)
+}
+
+func (o *jobOutput) finish(ctx context.Context, results RemoteCmdResults) {
+	close(o.stop)
+	<-o.done
+
+	o.mu.Lock()
+	for _, res := range results {
+		if res != nil {
+			o.job.Hosts[res.Idx] = newTranscriptStatus(res)
+		}
+	}
+	now := time.Now()
+	o.job.State = JobFinished
+	o.job.EndTime = &now
+	o.job.Log = detachedRunnerLog.Lines()
+	o.mu.Unlock()
+
+	o.flush(ctx)
+}
+
+// RenderJobStarted tells how to check on the job which was just started.
+func RenderJobStarted(ctx context.Context, w io.Writer, job *Job) error {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	if cfg.JsonOutput {
+		return jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w).Encode(map[string]string{"job": job.ID})
+	}
+
+	fmt.Fprintf(w, "Started job %s on %d hosts, check on it with: tips jobs show %s\n", job.ID, len(job.Hosts), job.ID)
+	return nil
+}
+
+// RenderJobsRemoved confirms the jobs are gone.
+func RenderJobsRemoved(ctx context.Context, w io.Writer, ids []string) error {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	if cfg.JsonOutput {
+		return jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w).Encode(map[string][]string{"removed": ids})
+	}
+
+	for _, id := range ids {
+		fmt.Fprintf(w, "Removed job %s\n", id)
+	}
+	return nil
+}
+
+// RenderJobs lists the jobs, one per line.
+func RenderJobs(ctx context.Context, w io.Writer, jobs []*Job) error {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	if cfg.JsonOutput {
+		return jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w).Encode(jobs)
+	}
+
+	if len(jobs) == 0 {
+		fmt.Fprintln(w, ui.Styles.Faint.Render("No jobs yet, start one with --detach."))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+	fmt.Fprintln(tw, "ID\tState\tStarted\tHosts\tSucceeded\tFailed\tDesc")
+	for _, job := range jobs {
+		counts := job.Counts()
+		unsuccessful := counts[StatusFailed.String()] + counts[StatusTimedOut.String()] +
+			counts[StatusInterrupted.String()]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n", job.ID, job.State, humanize.Time(job.StartTime),
+			len(job.Hosts), counts[StatusSucceeded.String()], unsuccessful, job.Desc)
+	}
+	return tw.Flush()
+}
+
+// RenderJob renders everything known about the job, along with how each of its hosts is faring.
+func RenderJob(ctx context.Context, w io.Writer, job *Job) error {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	if cfg.JsonOutput {
+		return jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w).Encode(job)
+	}
+
+	fmt.Fprintf(w, "%s %s (%s, pid: %d)\n", ui.Styles.Faint.Render("Job:"), ui.Styles.Bold.Render(job.ID),
+		job.State, job.PID)
+	fmt.Fprintf(w, "%s %s\n", ui.Styles.Faint.Render("Run:"), job.Desc)
+	fmt.Fprintf(w, "%s %s\n", ui.Styles.Faint.Render("Query:"), job.Query)
+	if len(job.Error) > 0 {
+		fmt.Fprintf(w, "%s %s\n", ui.Styles.Faint.Render("Error:"), job.Error)
+	}
+
+	elapsed := time.Since(job.StartTime)
+	if job.EndTime != nil {
+		elapsed = job.EndTime.Sub(job.StartTime)
+	}
+	fmt.Fprintf(w, "%s %s, elapsed (secs): %0.2f\n", ui.Styles.Faint.Render("Started:"),
+		job.StartTime.Format(time.RFC1123), elapsed.Seconds())
+
+	counts := job.Counts()
+	var tallies []string
+	for _, status := range []string{hostStateRunning, hostStateQueued, StatusSucceeded.String(), StatusFailed.String(),
+		StatusTimedOut.String(), StatusInterrupted.String(), StatusSkipped.String()} {
+		if counts[status] > 0 {
+			tallies = append(tallies, fmt.Sprintf("%s: %d", status, counts[status]))
+		}
+	}
+	fmt.Fprintf(w, "%s %d (%s)\n\n", ui.Styles.Faint.Render("Hosts:"), len(job.Hosts), strings.Join(tallies, ", "))
+
+	tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+	fmt.Fprintln(tw, "No\tHost\tStatus\tExit Code\tElapsed (secs)\tError")
+	for _, h := range job.Hosts {
+		name := h.Host
+		if len(h.Alias) > 0 {
+			name = h.Alias
+		}
+
+		exitCode, elapsed := "", ""
+		switch h.Status {
+		case hostStateQueued, StatusSkipped.String():
+		case hostStateRunning:
+			elapsed = fmt.Sprintf("%0.2f", time.Since(*h.StartTime).Seconds())
+		default:
+			exitCode = fmt.Sprintf("%d", h.ExitCode)
+			elapsed = fmt.Sprintf("%0.2f", h.ElapsedSecs)
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\t%s\t%s\n", h.Idx, name, h.Status, exitCode, elapsed, h.Error)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(job.Log) > 0 {
+		fmt.Fprintf(w, "\n%s\n", ui.Styles.Faint.Render("Runner log:"))
+		for _, l := range job.Log {
+			fmt.Fprintln(w, l)
+		}
+	}
+	return nil
+}
+
+// RenderJobLogs renders the output of a job just like the output of a remote command is streamed.
+func RenderJobLogs(ctx context.Context, w io.Writer, lines []*JobLogLine) error {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	if cfg.JsonOutput {
+		enc := jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w)
+		for _, l := range lines {
+			if err := enc.Encode(l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, l := range lines {
+		isStdErr := l.Stream == "stderr"
+		if isStdErr && !cfg.Stderr {
+			continue
+		}
+		RenderLogLine(ctx, w, l.Idx, isStdErr, l.Host, l.Alias, l.Text)
+	}
+	return nil
+}
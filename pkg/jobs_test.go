@@ -0,0 +1,351 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobStore(t *testing.T) {
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Tailnet = "jobs-test@test.com"
+	cfgCtx.Concurrency = 2
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	// The test should clean up this file.
+	defer func() {
+		assert.NoError(t, NewDB2[*Job](cfgCtx.Tailnet).Erase())
+	}()
+
+	store := NewJobStore(cfgCtx.Tailnet)
+
+	// Nothing was ever detached.
+	jobs, err := store.List(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	_, err = store.Get(ctx, "nope")
+	assert.Error(t, err)
+
+	hosts := []RemoteCmdHost{{Original: "blade-01"}, {Original: "blade-02"}}
+	job := NewJob("remote command: uptime", "blade", hosts)
+	assert.NoError(t, store.Save(ctx, job, nil))
+
+	// The runner picks up the job and records into it as the run goes.
+	cfgCtx.JobID = job.ID
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		fmt.Fprintf(req.Stdout, "up on %s\n", host)
+		if host == "blade-02" {
+			fmt.Fprintln(req.Stderr, "load is high")
+			return 1, errors.New("exit status 1")
+		}
+		return 0, nil
+	}}
+	ExecuteClusterRemoteCmd(ctx, io.Discard, executor, hosts, "uptime")
+
+	job, err = store.Get(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobFinished, job.State)
+	assert.Equal(t, os.Getpid(), job.PID)
+	assert.NotNil(t, job.EndTime)
+	assert.Equal(t, map[string]int{"succeeded": 1, "failed": 1}, job.Counts())
+
+	lines, err := store.Logs(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 3)
+
+	var b bytes.Buffer
+	assert.NoError(t, RenderJobLogs(ctx, &b, lines))
+	assert.Contains(t, b.String(), "up on blade-01")
+	assert.NotContains(t, b.String(), "load is high", "stderr is only shown with --stderr")
+
+	b.Reset()
+	assert.NoError(t, RenderJob(ctx, &b, job))
+	assert.Contains(t, b.String(), "Hosts: 2 (succeeded: 1, failed: 1)")
+
+	// A second job is listed first, while the first job keeps its logs to itself.
+	other := NewJob("remote command: hostname", "*", hosts[:1])
+	assert.NoError(t, store.Save(ctx, other, nil))
+
+	jobs, err = store.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{other.ID, job.ID}, []string{jobs[0].ID, jobs[1].ID})
+
+	lines, err = store.Logs(ctx, other.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, lines)
+
+	b.Reset()
+	assert.NoError(t, RenderJobs(ctx, &b, jobs))
+	assert.Contains(t, b.String(), "remote command: hostname")
+
+	// Lines of the same clock tick keep the order they arrived in, even across hosts.
+	tick := time.Now()
+	assert.NoError(t, store.Save(ctx, other, []*JobLogLine{
+		{JobID: other.ID, Seq: 1, TranscriptLine: TranscriptLine{Idx: 1, Time: tick, Text: "first"}},
+		{JobID: other.ID, Seq: 2, TranscriptLine: TranscriptLine{Idx: 0, Time: tick, Text: "second"}},
+		{JobID: other.ID, Seq: 3, TranscriptLine: TranscriptLine{Idx: 1, Time: tick, Text: "third"}},
+	}))
+	lines, err = store.Logs(ctx, other.ID)
+	assert.NoError(t, err)
+	var texts []string
+	for _, l := range lines {
+		texts = append(texts, l.Text)
+	}
+	assert.Equal(t, []string{"first", "second", "third"}, texts)
+}
+
+func TestJobCheckRunner(t *testing.T) {
+	job := &Job{State: JobRunning, PID: os.Getpid()}
+	job.checkRunner()
+	assert.Equal(t, JobRunning, job.State)
+
+	job = &Job{State: JobRunning}
+	job.checkRunner()
+	assert.Equal(t, JobLost, job.State, "a runner which never reported in is gone")
+
+	job = &Job{State: JobStarting}
+	job.checkRunner()
+	assert.Equal(t, JobStarting, job.State, "the runner wasn't started yet")
+
+	// A runner which died before picking up the job.
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	assert.NoError(t, exited.Run())
+	job = &Job{State: JobStarting, PID: exited.Process.Pid}
+	job.checkRunner()
+	assert.Equal(t, JobLost, job.State)
+}
+
+func TestJobRecordRunnerExit(t *testing.T) {
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Tailnet = "jobs-exit-test@test.com"
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	// The test should clean up this file.
+	defer func() {
+		assert.NoError(t, NewDB2[*Job](cfgCtx.Tailnet).Erase())
+	}()
+
+	store := NewJobStore(cfgCtx.Tailnet)
+	hosts := []RemoteCmdHost{{Original: "blade-01"}}
+
+	// The runner bailed out before it ever picked up the job.
+	job := NewJob("remote command: uptime", "blade", hosts)
+	assert.NoError(t, store.Save(ctx, job, nil))
+	assert.NoError(t, store.setRunner(ctx, job.ID, os.Getpid()))
+
+	detachedRunnerLog.Write([]byte("WARN something is off\n"))
+	assert.NoError(t, store.RecordRunnerExit(ctx, job.ID, errors.New("no hosts matched")))
+
+	job, err := store.Get(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobFailed, job.State)
+	assert.Equal(t, os.Getpid(), job.PID)
+	assert.Equal(t, "no hosts matched", job.Error)
+	assert.Contains(t, job.Log, "WARN something is off")
+
+	var b bytes.Buffer
+	assert.NoError(t, RenderJob(ctx, &b, job))
+	assert.Contains(t, b.String(), "Error: no hosts matched")
+	assert.Contains(t, b.String(), "WARN something is off")
+
+	// Once the runner picked up the job, its pid is no longer the starter's to record.
+	running := NewJob("remote command: uptime", "blade", hosts)
+	running.State = JobRunning
+	running.PID = os.Getpid()
+	assert.NoError(t, store.Save(ctx, running, nil))
+	assert.NoError(t, store.setRunner(ctx, running.ID, 1))
+
+	// A finished job is left be, even when the runner returns an error such as failed hosts.
+	running.State = JobFinished
+	assert.NoError(t, store.Save(ctx, running, nil))
+	assert.NoError(t, store.RecordRunnerExit(ctx, running.ID, errors.New("remote command failed")))
+
+	running, err = store.Get(ctx, running.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobFinished, running.State)
+	assert.Equal(t, os.Getpid(), running.PID)
+	assert.Empty(t, running.Error)
+}
+
+func TestRunnerLog(t *testing.T) {
+	l := &runnerLog{}
+	l.Write([]byte("first\nsec"))
+	l.Write([]byte("ond\n"))
+	assert.Equal(t, []string{"first", "second"}, l.Lines())
+
+	for i := 0; i < runnerLogLines; i++ {
+		fmt.Fprintf(l, "line %d\n", i)
+	}
+	lines := l.Lines()
+	assert.Len(t, lines, runnerLogLines, "only the last lines are kept")
+	assert.Equal(t, fmt.Sprintf("line %d", runnerLogLines-1), lines[len(lines)-1])
+}
+
+func TestJobStorePrune(t *testing.T) {
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Tailnet = "jobs-prune-test@test.com"
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	// The test should clean up this file.
+	defer func() {
+		assert.NoError(t, NewDB2[*Job](cfgCtx.Tailnet).Erase())
+	}()
+
+	store := NewJobStore(cfgCtx.Tailnet)
+	hosts := []RemoteCmdHost{{Original: "blade-01"}}
+	longAgo := time.Now().Add(-48 * time.Hour)
+
+	// Over long ago, its output goes along with it.
+	expired := NewJob("remote command: uptime", "blade", hosts)
+	expired.State = JobFinished
+	expired.EndTime = &longAgo
+	line := &JobLogLine{JobID: expired.ID, Seq: 1, TranscriptLine: TranscriptLine{Text: "up"}}
+	assert.NoError(t, store.Save(ctx, expired, []*JobLogLine{line}))
+
+	// Lost long ago, it never got to record an end.
+	lost := NewJob("remote command: uptime", "blade", hosts)
+	lost.ID += "-lost"
+	lost.State = JobLost
+	lost.StartTime = longAgo
+	assert.NoError(t, store.Save(ctx, lost, nil))
+
+	// Just over, and started long ago yet still running.
+	recent := NewJob("remote command: hostname", "blade", hosts)
+	recent.ID += "-recent"
+	recent.State = JobFinished
+	now := time.Now()
+	recent.EndTime = &now
+	running := NewJob("remote command: sleep", "blade", hosts)
+	running.ID += "-running"
+	running.State = JobRunning
+	running.PID = os.Getpid()
+	running.StartTime = longAgo
+	assert.NoError(t, store.Save(ctx, recent, nil))
+	assert.NoError(t, store.Save(ctx, running, nil))
+
+	pruned, err := store.Prune(ctx, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, pruned, "a retention of 0 keeps every job")
+
+	pruned, err = store.Prune(ctx, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{expired.ID, lost.ID}, pruned)
+
+	jobs, err := store.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+
+	lines, err := store.Logs(ctx, expired.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, lines)
+
+	_, err = store.Get(ctx, expired.ID)
+	assert.Error(t, err)
+}
+
+func TestRenderJobStarted(t *testing.T) {
+	cfgCtx := NewConfigCtx()
+	ctx := context.WithValue(context.Background(), CtxKeyConfig, cfgCtx)
+	job := NewJob("remote command: uptime", "blade", []RemoteCmdHost{{Original: "blade-01"}})
+
+	var b bytes.Buffer
+	assert.NoError(t, RenderJobStarted(ctx, &b, job))
+	assert.Contains(t, b.String(), "Started job "+job.ID+" on 1 hosts")
+
+	b.Reset()
+	cfgCtx.JsonOutput = true
+	assert.NoError(t, RenderJobStarted(ctx, &b, job))
+	assert.JSONEq(t, `{"job": "`+job.ID+`"}`, b.String())
+}
+
+func TestJobOutputBusyDB(t *testing.T) {
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Tailnet = "jobs-busy-test@test.com"
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	// The test should clean up this file.
+	defer func() {
+		assert.NoError(t, NewDB2[*Job](cfgCtx.Tailnet).Erase())
+	}()
+
+	store := NewJobStore(cfgCtx.Tailnet)
+	hosts := []RemoteCmdHost{{Original: "blade-01"}}
+	job := NewJob("remote command: uptime", "blade", hosts)
+	job.Hosts = queuedHosts(hosts)
+	assert.NoError(t, store.Save(ctx, job, nil))
+
+	o := &jobOutput{store: store, job: job}
+	o.line(ctx, hostLine{idx: 0, hostname: "blade-01", line: "first"})
+
+	// Another process holding on to the db keeps the flush waiting on its lock.
+	blocker := NewDB2[*Job](cfgCtx.Tailnet)
+	assert.NoError(t, blocker.Open())
+
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		o.flush(ctx)
+	}()
+
+	// Meanwhile the output of the hosts isn't held up.
+	time.Sleep(time.Millisecond * 100)
+	startTime := time.Now()
+	o.hostStarted(ctx, 0)
+	o.line(ctx, hostLine{idx: 0, hostname: "blade-01", line: "second"})
+	assert.Less(t, time.Since(startTime), time.Millisecond*500)
+
+	// The failed flush keeps its lines in front of the new ones, until the db is free again.
+	<-flushed
+	assert.NoError(t, blocker.Close())
+	o.flush(ctx)
+
+	lines, err := store.Logs(ctx, job.ID)
+	assert.NoError(t, err)
+	var texts []string
+	for _, l := range lines {
+		texts = append(texts, l.Text)
+	}
+	assert.Equal(t, []string{"first", "second"}, texts)
+
+	job, err = store.Get(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, hostStateRunning, job.Hosts[0].Status)
+}
@@ -0,0 +1,106 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/deckarep/tips/pkg/tailscale_cli"
+)
+
+// Pinger pings a single Tailscale IP or MagicDNS name, tailscale_cli.Ping is the one used for real.
+type Pinger func(ctx context.Context, target string, timeout time.Duration) (*tailscale_cli.PingResult, error)
+
+// PingDevicesTable pings every device of the table over the tailnet, as many at once as the concurrency allows. The
+// table then gets the reachable, latency and path columns and is sorted once more, so the sort order may use them
+// too: --sort 'latency:dsc'. Only failing to ping at all is an error, unreachable devices are simply reported so.
+func PingDevicesTable(ctx context.Context, tbl *GeneralTableView, ping Pinger) error {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	eachDevice(ctx, tbl.Devices, func(dev *WrappedDevice) {
+		res, err := ping(ctx, deviceAddress(dev), cfg.TailscaleCLI.Timeout)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		dev.PingInfo = res
+	})
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if len(cfg.SortOrder) > 0 {
+		dynamicSortDevices(tbl.Devices, cfg.SortOrder)
+	}
+
+	hasEnrichedInfo := len(tbl.Devices) > 0 && tbl.Devices[0].EnrichedInfo != nil
+	tbl.Headers = getHeaders(ctx, hasEnrichedInfo, true)
+	fillTableRows(ctx, tbl, tbl.Devices)
+
+	return nil
+}
+
+// eachDevice calls fn for every device, as many at once as the concurrency allows, and waits for all of them.
+func eachDevice(ctx context.Context, devs []*WrappedDevice, fn func(dev *WrappedDevice)) {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, max(1, cfg.Concurrency))
+	)
+
+	for _, dev := range devs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(dev *WrappedDevice) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(dev)
+		}(dev)
+	}
+	wg.Wait()
+}
+
+// deviceAddress is what a device is reached at over the tailnet, its IPv4 address when known.
+func deviceAddress(dev *WrappedDevice) string {
+	if len(dev.Addresses) > 0 {
+		return dev.Addresses[0]
+	}
+	return dev.Name
+}
@@ -0,0 +1,109 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/deckarep/tips/pkg/tailscale_cli"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPingDevicesTable(t *testing.T) {
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 2
+	cfgCtx.SortOrder = ParseSortString("latency:asc")
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+	ctx = context.WithValue(ctx, CtxKeyUserQuery, "*")
+
+	devList := []*WrappedDevice{
+		{Device: tailscale.Device{Name: "a.ts.net", Addresses: []string{"100.64.0.1"}}},
+		{Device: tailscale.Device{Name: "b.ts.net", Addresses: []string{"100.64.0.2"}}},
+		{Device: tailscale.Device{Name: "c.ts.net"}},
+	}
+	tbl, err := ProcessDevicesTable(ctx, devList)
+	assert.NoError(t, err)
+	assert.NotContains(t, tbl.HeaderTitles(), HdrLatency.Title, "ping columns need pinged devices")
+
+	replies := map[string]*tailscale_cli.PingResult{
+		"100.64.0.1": {Reachable: true, Latency: 40 * time.Millisecond, DERPRegion: "nyc"},
+		"100.64.0.2": {Reachable: true, Latency: 3 * time.Millisecond, Direct: true, Endpoint: "203.0.113.5:41641"},
+		"c.ts.net":   {Err: "no reply"},
+	}
+	err = PingDevicesTable(ctx, tbl, func(ctx context.Context, target string, timeout time.Duration) (*tailscale_cli.PingResult, error) {
+		return replies[target], nil
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"No", "Machine", "Ipv4", "Tags", "User", "Version", "Exit Status", "Reachable", "Latency",
+		"Path"}, tbl.HeaderTitles())
+
+	// Sorted by latency, the unreachable device goes last.
+	assert.Equal(t, []string{"b.ts.net", "a.ts.net", "c.ts.net"},
+		[]string{tbl.Devices[0].Name, tbl.Devices[1].Name, tbl.Devices[2].Name})
+	assert.Equal(t, []string{checkField, "3ms", "direct (203.0.113.5:41641)"}, tbl.Rows[0][7:])
+	assert.Equal(t, []string{checkField, "40ms", "derp (nyc)"}, tbl.Rows[1][7:])
+	assert.Equal(t, []string{"no", "n/a", "n/a"}, tbl.Rows[2][7:])
+
+	// Not being able to ping at all fails the whole thing.
+	err = PingDevicesTable(ctx, tbl, func(ctx context.Context, target string, timeout time.Duration) (*tailscale_cli.PingResult, error) {
+		return nil, errors.New("tailscale is not installed")
+	})
+	assert.Error(t, err)
+}
+
+func TestDynamicSortDevicesPing(t *testing.T) {
+	direct := &WrappedDevice{Device: tailscale.Device{Name: "direct"},
+		PingInfo: &tailscale_cli.PingResult{Reachable: true, Direct: true, Latency: time.Millisecond * 30}}
+	relayed := &WrappedDevice{Device: tailscale.Device{Name: "relayed"},
+		PingInfo: &tailscale_cli.PingResult{Reachable: true, Latency: time.Millisecond * 10}}
+	down := &WrappedDevice{Device: tailscale.Device{Name: "down"}, PingInfo: &tailscale_cli.PingResult{}}
+
+	names := func(devs []*WrappedDevice) []string {
+		var n []string
+		for _, d := range devs {
+			n = append(n, d.Name)
+		}
+		return n
+	}
+
+	devs := []*WrappedDevice{down, direct, relayed}
+	dynamicSortDevices(devs, ParseSortString("latency:dsc"))
+	assert.Equal(t, []string{"direct", "relayed", "down"}, names(devs))
+
+	dynamicSortDevices(devs, ParseSortString("reachable:dsc"))
+	assert.Equal(t, []string{"down", "direct", "relayed"}, names(devs))
+
+	dynamicSortDevices(devs, ParseSortString("path:asc,latency:asc"))
+	assert.Equal(t, []string{"direct", "relayed", "down"}, names(devs))
+}
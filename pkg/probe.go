@@ -0,0 +1,160 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PortState is what probing a tcp port found.
+type PortState string
+
+const (
+	// PortOpen accepted the connection.
+	PortOpen PortState = "open"
+	// PortClosed actively refused the connection, the host is up but nothing listens.
+	PortClosed PortState = "closed"
+	// PortFiltered never answered in time or was otherwise unreachable, typically a firewall or ACL drops the packets.
+	PortFiltered PortState = "filtered"
+
+	// DefaultProbeTimeout is how long a single connection attempt may take.
+	DefaultProbeTimeout = time.Second * 2
+
+	// portMatchNamePrefix prefixes the match name of the per port columns: port:443.
+	portMatchNamePrefix = "port:"
+)
+
+// Dialer opens a connection like net.Dialer.DialContext does.
+type Dialer func(ctx context.Context, network, address string) (net.Conn, error)
+
+// ParsePorts parses a comma separated list of tcp ports, such as "22,443,9100". Duplicates are dropped while the
+// order is kept, as it's the order of the columns.
+func ParsePorts(s string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if len(p) == 0 {
+			continue
+		}
+
+		port, err := strconv.Atoi(p)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port: %q, ports must be numbers from 1 to 65535", p)
+		}
+
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+
+	return ports, nil
+}
+
+// ProbeDevicesTable attempts a tcp connection to every port on every device of the table, as many devices at once as
+// the concurrency allows and all ports of a device at once. The table then gets a column per port holding its state,
+// making it a matrix of host × port → open, closed or filtered.
+func ProbeDevicesTable(ctx context.Context, tbl *GeneralTableView, ports []int, timeout time.Duration, dial Dialer) {
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+
+	eachDevice(ctx, tbl.Devices, func(dev *WrappedDevice) {
+		states := make(map[int]PortState, len(ports))
+
+		var (
+			wg sync.WaitGroup
+			mu sync.Mutex
+		)
+		for _, port := range ports {
+			wg.Add(1)
+			go func(port int) {
+				defer wg.Done()
+				state := probePort(ctx, dial, net.JoinHostPort(deviceAddress(dev), strconv.Itoa(port)), timeout)
+
+				mu.Lock()
+				states[port] = state
+				mu.Unlock()
+			}(port)
+		}
+		wg.Wait()
+
+		dev.ProbeInfo = states
+	})
+
+	hasEnrichedInfo := len(tbl.Devices) > 0 && tbl.Devices[0].EnrichedInfo != nil
+	tbl.Headers = getHeaders(ctx, hasEnrichedInfo, false)
+	for _, port := range ports {
+		tbl.Headers = append(tbl.Headers, Header{
+			Title:     fmt.Sprintf("%d/tcp", port),
+			MatchName: HeaderMatchName(portMatchNamePrefix + strconv.Itoa(port)),
+		})
+	}
+	fillTableRows(ctx, tbl, tbl.Devices)
+}
+
+func probePort(ctx context.Context, dial Dialer, address string, timeout time.Duration) PortState {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := dial(ctx, "tcp", address)
+	if err == nil {
+		conn.Close()
+		return PortOpen
+	}
+
+	if errors.Is(err, errConnRefused) {
+		return PortClosed
+	}
+	return PortFiltered
+}
+
+// portState evaluates the column of a port, such as port:443.
+func (w *WrappedDevice) portState(headerMatchName HeaderMatchName) (string, bool) {
+	p, ok := strings.CutPrefix(string(headerMatchName), portMatchNamePrefix)
+	if !ok {
+		return "", false
+	}
+
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return "", false
+	}
+
+	if state, exists := w.ProbeInfo[port]; exists {
+		return string(state), true
+	}
+	return "n/a", true
+}
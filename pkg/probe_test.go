@@ -0,0 +1,115 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tailscale/tailscale-client-go/tailscale"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePorts(t *testing.T) {
+	ports, err := ParsePorts("22, 443,9100,22,")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{22, 443, 9100}, ports)
+
+	ports, err = ParsePorts("")
+	assert.NoError(t, err)
+	assert.Empty(t, ports)
+
+	for _, s := range []string{"ssh", "0", "65536", "22-25"} {
+		_, err = ParsePorts(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestProbeDevicesTable(t *testing.T) {
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 2
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+	ctx = context.WithValue(ctx, CtxKeyUserQuery, "*")
+
+	// One port is listened on, the other was just released so connections to it are refused.
+	open, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer open.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	closed.Close()
+
+	openPort := open.Addr().(*net.TCPAddr).Port
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+
+	devList := []*WrappedDevice{
+		{Device: tailscale.Device{Name: "up.ts.net", Addresses: []string{"127.0.0.1"}}},
+		{Device: tailscale.Device{Name: "firewalled.ts.net", Addresses: []string{"100.64.0.2"}}},
+	}
+	tbl, err := ProcessDevicesTable(ctx, devList)
+	assert.NoError(t, err)
+
+	// The firewalled device never answers, the other one is dialed for real.
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, _ := net.SplitHostPort(address); host == "100.64.0.2" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return (&net.Dialer{}).DialContext(ctx, network, address)
+	}
+
+	ProbeDevicesTable(ctx, tbl, []int{openPort, closedPort}, time.Millisecond*50, dial)
+
+	cols := len(tbl.Headers)
+	assert.Equal(t, strconv.Itoa(openPort)+"/tcp", tbl.Headers[cols-2].Title)
+	assert.Equal(t, strconv.Itoa(closedPort)+"/tcp", tbl.Headers[cols-1].Title)
+
+	assert.Equal(t, []string{"open", "closed"}, tbl.Rows[0][cols-2:])
+	assert.Equal(t, []string{"filtered", "filtered"}, tbl.Rows[1][cols-2:])
+	assert.Equal(t, map[int]PortState{openPort: PortOpen, closedPort: PortClosed}, devList[0].ProbeInfo)
+}
+
+func TestProbePort(t *testing.T) {
+	ctx := context.Background()
+
+	// Fails the dial just as the net package does, with the os error wrapped up.
+	failWith := func(err error) Dialer {
+		return func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("connect", err)}
+		}
+	}
+
+	assert.Equal(t, PortClosed, probePort(ctx, failWith(errConnRefused), "100.64.0.1:22", time.Second))
+	assert.Equal(t, PortFiltered, probePort(ctx, failWith(context.DeadlineExceeded), "100.64.0.1:22", time.Second))
+	assert.Equal(t, PortFiltered, probePort(ctx, failWith(errors.New("no route to host")), "100.64.0.1:22", time.Second))
+}
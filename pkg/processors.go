@@ -86,7 +86,7 @@ func ProcessDevicesTable(ctx context.Context, devList []*WrappedDevice) (*Genera
 		}
 	}
 
-	hdrs := getHeaders(ctx, hasEnrichedInfo)
+	hdrs := getHeaders(ctx, hasEnrichedInfo, false)
 
 	// 3. Massage/Transform - final transformations here.
 	tbl := &GeneralTableView{
@@ -103,23 +103,30 @@ func ProcessDevicesTable(ctx context.Context, devList []*WrappedDevice) (*Genera
 		Headers: hdrs,
 	}
 
+	fillTableRows(ctx, tbl, slicedDevList)
+
+	return tbl, nil
+}
+
+// fillTableRows (re)builds the rows of the table from its headers, one row per device.
+func fillTableRows(ctx context.Context, tbl *GeneralTableView, devList []*WrappedDevice) {
 	// Pre-alloc size.
-	tbl.Rows = make([][]string, 0, len(slicedDevList))
+	tbl.Rows = make([][]string, 0, len(devList))
+	tbl.Devices = devList
+	tbl.Self = nil
 
-	for idx, dev := range slicedDevList {
+	for idx, dev := range devList {
 		if dev.EnrichedInfo != nil && dev.EnrichedInfo.IsSelf {
 			tbl.Self = &SelfView{
 				Index:   idx,
 				DNSName: dev.Name,
 			}
 		}
-		tbl.Rows = append(tbl.Rows, getRow(ctx, idx, hdrs, dev))
+		tbl.Rows = append(tbl.Rows, getRow(ctx, idx, tbl.Headers, dev))
 	}
-
-	return tbl, nil
 }
 
-func getHeaders(ctx context.Context, hasEnrichedInfo bool) []Header {
+func getHeaders(ctx context.Context, hasEnrichedInfo, hasPingInfo bool) []Header {
 	cfg := CtxAsConfig(ctx, CtxKeyConfig)
 
 	uniqHeaders := make(map[HeaderMatchName]Header)
@@ -137,8 +144,8 @@ func getHeaders(ctx context.Context, hasEnrichedInfo bool) []Header {
 	}
 
 	for _, hdr := range DefaultColumnSet {
-		if (hdr.ReqEnriched && !hasEnrichedInfo) || cfg.ColumnsExclude != nil && cfg.ColumnsExclude.Contains(string(hdr.MatchName)) {
-			// 1. Exclude this header if it requires enriched data and we don't have it.
+		if (hdr.ReqEnriched && !hasEnrichedInfo) || (hdr.ReqPing && !hasPingInfo) || cfg.ColumnsExclude != nil && cfg.ColumnsExclude.Contains(string(hdr.MatchName)) {
+			// 1. Exclude this header if it requires enriched or ping data and we don't have it.
 			// 2. Or when user requested to not include it.
 			continue
 		}
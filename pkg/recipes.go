@@ -0,0 +1,108 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/deckarep/tips/pkg/ui"
+)
+
+// Recipe is a remote command saved under a name in the recipes section of the config, along with the settings it
+// runs with by default. Any of these settings given as a flag wins over the recipe's.
+type Recipe struct {
+	Cmd         string `mapstructure:"cmd"`
+	Filter      string `mapstructure:"filter"`
+	Concurrency int    `mapstructure:"concurrency"`
+	Stderr      bool   `mapstructure:"stderr"`
+	// Template evaluates the cmd as a Go template for every host, just like the --template flag.
+	Template bool `mapstructure:"template"`
+	// Batch takes the same form as the --batch flag: a number of hosts or a percentage of hosts.
+	Batch string `mapstructure:"batch"`
+}
+
+// LookupRecipe returns the recipe by its name, names are case-insensitive as the config's keys are.
+func LookupRecipe(recipes map[string]Recipe, name string) (Recipe, error) {
+	r, ok := recipes[strings.ToLower(name)]
+	if !ok {
+		return Recipe{}, fmt.Errorf("unknown recipe: %q, the known recipes are: %s", name,
+			strings.Join(recipeNames(recipes), ", "))
+	}
+
+	if len(strings.TrimSpace(r.Cmd)) == 0 {
+		return Recipe{}, fmt.Errorf("the recipe %q has no cmd to run", name)
+	}
+
+	return r, nil
+}
+
+// CombinedFilter narrows the recipe's filter down further with the extra filter, both have to match.
+func (r Recipe) CombinedFilter(extra string) string {
+	switch {
+	case len(strings.TrimSpace(r.Filter)) == 0:
+		return extra
+	case len(strings.TrimSpace(extra)) == 0:
+		return r.Filter
+	default:
+		return fmt.Sprintf("(%s),(%s)", r.Filter, extra)
+	}
+}
+
+// RenderRecipes lists the recipes by name.
+func RenderRecipes(ctx context.Context, w io.Writer, recipes map[string]Recipe) error {
+	if len(recipes) == 0 {
+		fmt.Fprintln(w, ui.Styles.Faint.Render("No recipes yet, add them to the recipes section of the config."))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+	fmt.Fprintln(tw, "Recipe\tCmd\tFilter\tConcurrency\tBatch\tStderr\tTemplate")
+	for _, name := range recipeNames(recipes) {
+		r := recipes[name]
+
+		concurrency := ""
+		if r.Concurrency > 0 {
+			concurrency = fmt.Sprintf("%d", r.Concurrency)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%t\t%t\n", name, r.Cmd, r.Filter, concurrency, r.Batch, r.Stderr,
+			r.Template)
+	}
+	return tw.Flush()
+}
+
+func recipeNames(recipes map[string]Recipe) []string {
+	names := make([]string, 0, len(recipes))
+	for name := range recipes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,79 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupRecipe(t *testing.T) {
+	recipes := map[string]Recipe{
+		"restart-nginx": {Cmd: "sudo systemctl restart nginx", Filter: "tag:web", Batch: "5"},
+		"broken":        {Filter: "tag:web"},
+	}
+
+	r, err := LookupRecipe(recipes, "Restart-Nginx")
+	assert.NoError(t, err)
+	assert.Equal(t, "sudo systemctl restart nginx", r.Cmd)
+
+	_, err = LookupRecipe(recipes, "reboot")
+	assert.ErrorContains(t, err, "broken, restart-nginx", "the known recipes are listed")
+
+	_, err = LookupRecipe(recipes, "broken")
+	assert.Error(t, err, "a recipe without a cmd can't run")
+}
+
+func TestRecipeCombinedFilter(t *testing.T) {
+	assert.Equal(t, "", Recipe{}.CombinedFilter(""))
+	assert.Equal(t, "tag:web", Recipe{Filter: "tag:web"}.CombinedFilter(""))
+	assert.Equal(t, "os:linux", Recipe{}.CombinedFilter("os:linux"))
+
+	combined := Recipe{Filter: "tag:web"}.CombinedFilter("tag:prod|tag:dev")
+	assert.Equal(t, "(tag:web),(tag:prod|tag:dev)", combined)
+
+	_, err := ParseFilter(combined)
+	assert.NoError(t, err, "the combined filter must still parse")
+}
+
+func TestRenderRecipes(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, RenderRecipes(context.Background(), &buf, nil))
+	assert.Contains(t, buf.String(), "No recipes yet")
+
+	buf.Reset()
+	assert.NoError(t, RenderRecipes(context.Background(), &buf, map[string]Recipe{
+		"uptime":        {Cmd: "uptime"},
+		"restart-nginx": {Cmd: "sudo systemctl restart nginx", Filter: "tag:web", Concurrency: 2},
+	}))
+	out := buf.String()
+	assert.Less(t, bytes.Index(buf.Bytes(), []byte("restart-nginx")), bytes.Index(buf.Bytes(), []byte("uptime")))
+	assert.Contains(t, out, "sudo systemctl restart nginx")
+	assert.Contains(t, out, "tag:web")
+}
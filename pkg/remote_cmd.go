@@ -26,52 +26,194 @@ SOFTWARE.
 package pkg
 
 import (
-	"bufio"
+	"bytes"
 	"context"
-	"fmt"
+	"errors"
 	"io"
-	"os"
-	"os/exec"
-	"os/signal"
-	"runtime"
-	"strings"
 	"sync"
 	"sync/atomic"
-	"syscall"
+	"text/template"
 	"time"
 
-	"github.com/deckarep/tips/pkg/utils"
-
 	"github.com/charmbracelet/log"
 )
 
 const (
-	maxLinesToCluster    = 10
-	maxCompletionTimeout = time.Millisecond * 1
-)
-
-var (
-	// binarySearchPathCandidates denotes priority per os. For ssh-based commands we attempt to utilize ssh via
-	// the Tailscale binary if it is present. Otherwise, we fall back to the regular ssh binary.
-	// This should ultimately be overridable within the config settings.
-	binarySearchPathCandidates = map[string][]string{
-		"linux": {
-			// These are currently untested
-			"/usr/bin/Tailscale ssh",
-			"/usr/bin/ssh",
-		},
-		"darwin": {
-			// When installed as tailscaled open-source version
-			"/Applications/Tailscale.app/Contents/MacOS/Tailscale ssh",
-			// When installed as sandboxed (Mac App Store | System Extension version)
-			"/usr/bin/ssh",
-		},
-	}
+	// hostLineBuffer is how many lines of output each running host may have in flight before it's held back until the
+	// output catches up.
+	hostLineBuffer = 10
 )
 
 type RemoteCmdHost struct {
 	Original string
 	Alias    string
+	// Device is the device the host was selected from, it may be nil.
+	Device *WrappedDevice
+}
+
+// Tags returns the tags of the host's device, if any.
+func (h RemoteCmdHost) Tags() []string {
+	if h.Device == nil {
+		return nil
+	}
+	return h.Device.Tags
+}
+
+// ErrDeadlineReached is the cause of a run's context being cancelled once its deadline passed.
+var ErrDeadlineReached = errors.New("deadline reached")
+
+// RemoteCmdStatus is the final state a host ended up in after a cluster run.
+type RemoteCmdStatus int
+
+const (
+	StatusSucceeded RemoteCmdStatus = iota
+	StatusFailed
+	// StatusSkipped means the host was never started, such as when a rollout was halted. The result's Err is set when
+	// it was skipped because the run was cut short.
+	StatusSkipped
+	// StatusTimedOut means the host was killed for exceeding either the per-host timeout or the run's deadline.
+	StatusTimedOut
+	// StatusInterrupted means the host was stopped because the run was interrupted, such as by Ctrl-C.
+	StatusInterrupted
+)
+
+func (s RemoteCmdStatus) String() string {
+	switch s {
+	case StatusSucceeded:
+		return "succeeded"
+	case StatusFailed:
+		return "failed"
+	case StatusSkipped:
+		return "skipped"
+	case StatusTimedOut:
+		return "timed out"
+	case StatusInterrupted:
+		return "interrupted"
+	default:
+		return "unknown"
+	}
+}
+
+// RemoteCmdResult captures everything known about the execution of a remote command on a single host.
+type RemoteCmdResult struct {
+	Host      RemoteCmdHost
+	Idx       int
+	Status    RemoteCmdStatus
+	ExitCode  int
+	StartTime time.Time
+	EndTime   time.Time
+	Stdout    []byte
+	Stderr    []byte
+	// Err is the error returned by the ssh process (or its setup) when the remote command did not succeed.
+	Err error
+}
+
+// Success reports whether the remote command ran to completion with a zero exit code.
+func (r *RemoteCmdResult) Success() bool {
+	return r.Status == StatusSucceeded
+}
+
+// CutShort reports whether the host never started because the run was interrupted or its deadline passed.
+func (r *RemoteCmdResult) CutShort() bool {
+	return r.Status == StatusSkipped && (errors.Is(r.Err, ErrDeadlineReached) || errors.Is(r.Err, ErrInterrupted))
+}
+
+// Elapsed returns how long the remote command ran for on this host.
+func (r *RemoteCmdResult) Elapsed() time.Duration {
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// RemoteCmdResults is the per-host result set of a cluster-wide remote command, ordered by host index.
+type RemoteCmdResults []*RemoteCmdResult
+
+// Successes returns the number of hosts where the remote command succeeded.
+func (rs RemoteCmdResults) Successes() int {
+	return len(rs.WithStatus(StatusSucceeded))
+}
+
+// Failed returns only the results of hosts where the remote command ran but did not succeed.
+func (rs RemoteCmdResults) Failed() RemoteCmdResults {
+	return rs.WithStatus(StatusFailed)
+}
+
+// Unsuccessful returns the results of hosts that either failed, timed out or were interrupted, in host index order.
+// Hosts which never started because the run was interrupted or its deadline passed count too, part of the fleet never
+// ran after all.
+func (rs RemoteCmdResults) Unsuccessful() RemoteCmdResults {
+	var matched RemoteCmdResults
+	for _, r := range rs {
+		if r.Status == StatusFailed || r.Status == StatusTimedOut || r.Status == StatusInterrupted || r.CutShort() {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// CutShort returns the results of hosts which were skipped because the run was cut short, as opposed to a rollout
+// which halted on purpose.
+func (rs RemoteCmdResults) CutShort() RemoteCmdResults {
+	var matched RemoteCmdResults
+	for _, r := range rs {
+		if r.CutShort() {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// Interrupted reports whether the run was interrupted, whether or not any host was running at the time.
+func (rs RemoteCmdResults) Interrupted() bool {
+	for _, r := range rs {
+		if r.Status == StatusInterrupted || (r.Status == StatusSkipped && errors.Is(r.Err, ErrInterrupted)) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithStatus returns only the results of hosts that ended up in the given status.
+func (rs RemoteCmdResults) WithStatus(status RemoteCmdStatus) RemoteCmdResults {
+	var matched RemoteCmdResults
+	for _, r := range rs {
+		if r.Status == status {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// Summary tallies the results by status.
+func (rs RemoteCmdResults) Summary(elapsed time.Duration) RemoteCmdSummary {
+	var sum RemoteCmdSummary
+	for _, r := range rs {
+		switch r.Status {
+		case StatusSucceeded:
+			sum.Successes++
+		case StatusFailed:
+			sum.Failures++
+		case StatusSkipped:
+			sum.Skipped++
+		case StatusTimedOut:
+			sum.TimedOut++
+		case StatusInterrupted:
+			sum.Interrupted++
+			sum.InterruptedHosts = append(sum.InterruptedHosts, hostDisplayName(r.Host))
+		}
+	}
+	sum.Elapsed = elapsed
+	return sum
+}
+
+// RemoteCmdSummary holds the final tallies of a cluster run.
+type RemoteCmdSummary struct {
+	Successes uint32
+	Failures  uint32
+	Skipped   uint32
+	TimedOut  uint32
+	// Interrupted counts the hosts stopped by an interrupt, InterruptedHosts names them.
+	Interrupted      uint32
+	InterruptedHosts []string
+	Elapsed          time.Duration
 }
 
 type hostLine struct {
@@ -80,222 +222,377 @@ type hostLine struct {
 	alias    string
 	idx      int
 	line     string
+	ts       time.Time
+	// started is only set on the first hostLine of a host, it marks the host as started and carries no output.
+	started bool
+	// result is only set on the final hostLine of a host, it marks the host as completed and carries no output.
+	result *RemoteCmdResult
 }
 
-type chanCompletions struct {
-	hostname  string
-	alias     string
-	idx       int
-	completed bool
-	ch        chan hostLine
+// hostTask executes a unit of work against a single host. It emits any output as lines on outputChan and must never
+// return a nil result.
+type hostTask func(ctx context.Context, idx int, host RemoteCmdHost, outputChan chan<- hostLine) *RemoteCmdResult
+
+// hostPlan describes what a hostTask would run on a single host without running anything, it's what a dry run shows.
+type hostPlan func(ctx context.Context, idx int, host RemoteCmdHost) (string, error)
+
+// ExecuteClusterRemoteCmd runs the remote command across all hosts via the executor, streaming their output to w and
+// returns the per-host results, in host index order, once every host has completed. Hosts are executed in the batches
+// dictated by the configured rollout strategy, which by default is just a single batch containing every host.
+func ExecuteClusterRemoteCmd(ctx context.Context, w io.Writer, executor RemoteExecutor, hosts []RemoteCmdHost,
+	remoteCmd string) RemoteCmdResults {
+	// A templated remote command is evaluated for each host, see HostTemplateData. Templating is opt-in, as plenty of
+	// everyday commands carry {{ }} of their own, such as: docker ps --format '{{.Names}}'
+	var (
+		tmpl    *template.Template
+		tmplErr error
+	)
+	if cfg := CtxAsConfig(ctx, CtxKeyConfig); cfg.Template {
+		tmpl, tmplErr = parseRemoteCmdTemplate(remoteCmd)
+	}
+
+	var hostCmd = func(ctx context.Context, idx int, host RemoteCmdHost) (string, error) {
+		if tmplErr != nil {
+			return "", tmplErr
+		}
+		if tmpl == nil {
+			return remoteCmd, nil
+		}
+		return renderRemoteCmd(ctx, tmpl, idx, host)
+	}
+
+	return executeCluster(ctx, w, hosts, "remote command: "+remoteCmd,
+		func(ctx context.Context, idx int, host RemoteCmdHost, outputChan chan<- hostLine) *RemoteCmdResult {
+			cmd, err := hostCmd(ctx, idx, host)
+			if err != nil {
+				return failedResult(idx, host, err)
+			}
+			return executeRemoteCmd(ctx, executor, idx, host, cmd, outputChan)
+		},
+		func(ctx context.Context, idx int, host RemoteCmdHost) (string, error) {
+			cmd, err := hostCmd(ctx, idx, host)
+			if err != nil {
+				return "", err
+			}
+			return executor.Describe(host.Original, &ExecRequest{Cmd: cmd, Tty: true, Tags: host.Tags()}), nil
+		})
 }
 
-func ExecuteClusterRemoteCmd(ctx context.Context, w io.Writer, hosts []RemoteCmdHost, remoteCmd string) {
+// executeCluster drives a hostTask across all hosts honoring the concurrency setting, rollout strategy and timeouts,
+// streams the output to w and finally renders the summary. The desc is only used to describe failures in the logs.
+// On a dry run nothing is executed at all, instead the plan is rendered and no results are returned.
+func executeCluster(ctx context.Context, w io.Writer, hosts []RemoteCmdHost, desc string, task hostTask,
+	plan hostPlan) RemoteCmdResults {
 	cfg := CtxAsConfig(ctx, CtxKeyConfig)
 	startTime := time.Now()
 
-	const (
-		// TODO: Make this configurable.
-		chanBuffer = 10
-	)
+	if cfg.DryRun {
+		renderDryRun(ctx, w, hosts, desc, plan)
+		return RemoteCmdResults{}
+	}
 
-	var (
-		allCompletions []*chanCompletions
-		sem            = make(chan struct{}, cfg.Concurrency)
+	// A single handler for the entire run, interrupting every host at once.
+	ctx, stopInterrupts := WithInterruptHandler(ctx)
+	defer stopInterrupts()
+
+	// The deadline bounds the entire run, once it passes every running host is killed via the context.
+	if cfg.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, cfg.Deadline, ErrDeadlineReached)
+		defer cancel()
+	}
 
-		totalErrors  atomic.Uint32
-		totalSuccess atomic.Uint32
-		wg           sync.WaitGroup
+	var (
+		rollout  = cfg.Rollout
+		batches  = rollout.Batches(len(hosts))
+		results  = make(RemoteCmdResults, len(hosts))
+		out      = newRemoteOutput(ctx, w, hosts)
+		failures atomic.Int32
 	)
 
-	wg.Add(len(hosts))
+	// halted reports whether no new hosts may be started.
+	var halted = func() bool {
+		return rollout.MaxFailures > 0 && int(failures.Load()) >= rollout.MaxFailures
+	}
 
-	// For each host, kick-off a goroutine to execute the remote command.
-	for idx, host := range hosts {
-		resultsChan := make(chan hostLine, chanBuffer)
+	for batchIdx, batch := range batches {
+		isCanary := rollout.Canary > 0 && batchIdx == 0
 
-		allCompletions = append(allCompletions, &chanCompletions{
-			ch:        resultsChan,
-			hostname:  host.Original,
-			alias:     host.Alias,
-			idx:       idx,
-			completed: false,
-		})
+		if batchIdx > 0 {
+			if halted() {
+				log.Warn("max failures reached, halting rollout", "maxFailures", rollout.MaxFailures)
+				skipHosts(hosts, batches[batchIdx:], results, nil)
+				break
+			}
 
-		go func(i int, hn, alias string, rch chan hostLine) {
-			sem <- struct{}{}
-			defer wg.Done()
-			if err := executeRemoteCmd(ctx, i, hn, alias, remoteCmd, rch); err != nil {
-				totalErrors.Add(1)
-				log.Error("error executing remote command for", "host", hn, "cmd", remoteCmd, "error", err)
-				return
+			if rollout.Pause > 0 {
+				log.Info("pausing before next batch", "pause", rollout.Pause)
+				select {
+				case <-time.After(rollout.Pause):
+				case <-ctx.Done():
+				}
 			}
-			totalSuccess.Add(1)
-		}(idx, host.Original, host.Alias, resultsChan)
-	}
+		}
 
-	// This blocks until all completions have shutdown.
-	// However, upon an early ssh connection error this polling will immediately fallthrough.
-	poll(ctx, w, sem, allCompletions)
+		if interrupted(ctx) {
+			log.Warn("interrupted, skipping the remaining hosts")
+			skipHosts(hosts, batches[batchIdx:], results, context.Cause(ctx))
+			break
+		}
 
-	// But we still want to wait for all goroutines executed above to run to completion.
-	wg.Wait()
+		if ctx.Err() != nil {
+			log.Warn("deadline reached, skipping the remaining hosts", "deadline", cfg.Deadline)
+			skipHosts(hosts, batches[batchIdx:], results, context.Cause(ctx))
+			break
+		}
+
+		if rollout.IsRolling() {
+			log.Info("starting batch", "batch", batchIdx+1, "of", len(batches), "hosts", len(batch), "canary", isCanary)
+		}
 
-	// Prints a summary at the end of success vs failures as well as how long it took in seconds.
-	if err := RenderRemoteSummary(ctx, w, totalSuccess.Load(), totalErrors.Load(), time.Since(startTime)); err != nil {
-		log.Error("error on rendering summary stats on remote execution command", "error", err)
+		executeBatch(ctx, out, hosts, batch, desc, task, results, &failures, halted)
+
+		// A failed canary means nothing else should be touched.
+		if isCanary && failures.Load() > 0 {
+			log.Warn("canary failed, halting rollout")
+			skipHosts(hosts, batches[batchIdx+1:], results, nil)
+			break
+		}
 	}
-}
 
-func executeRemoteCmd(ctx context.Context, idx int, host string, alias string, remoteCmd string, outputChan chan<- hostLine) error {
-	binPath, err := utils.SelectBinaryPath(runtime.GOOS, binarySearchPathCandidates)
-	if err != nil {
-		return err
+	out.finish(ctx, results)
+
+	// Prints a summary at the end of success vs failures as well as how long it took in seconds. As json, the summary
+	// was already emitted as the final event.
+	if !cfg.JsonOutput {
+		if err := RenderRemoteSummary(ctx, w, results.Summary(time.Since(startTime))); err != nil {
+			log.Error("error on rendering summary stats on remote execution command", "error", err)
+		}
 	}
 
-	// Construct the SSH command
-	// The double -t indicate we want to force ssh to use a terminal session (forced) this way
-	// it can propagate signals to the child process correctly and shut them down upon early
-	// termination. YOLO!
-	sshCmd := exec.Command(binPath, host, "-t", "-t", remoteCmd)
-	defer close(outputChan)
+	return results
+}
 
-	// Get the output pipe
-	stdout, err := sshCmd.StdoutPipe()
-	if err != nil {
-		return err
+// executeBatch runs the task over a single batch of hosts (by index) and blocks until they all complete.
+// Once halted returns true, any host in the batch that has not yet started is skipped instead.
+func executeBatch(ctx context.Context, out remoteOutput, hosts []RemoteCmdHost, batch []int, desc string, task hostTask,
+	results RemoteCmdResults, failures *atomic.Int32, halted func() bool) {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	workers := max(1, min(cfg.Concurrency, len(batch)))
+
+	var (
+		// Every host sends its output and finally its completion over this one channel. Being bounded, a slow output
+		// holds the hosts back rather than buffering without limit.
+		events = make(chan hostLine, workers*hostLineBuffer)
+		sem    = make(chan struct{}, workers)
+		wg     sync.WaitGroup
+	)
+
+	// Hosts are only started as slots free up, so even a huge batch never parks a goroutine per host.
+	go func() {
+		for _, idx := range batch {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(i int, h RemoteCmdHost) {
+				defer wg.Done()
+
+				res := runHost(ctx, i, h, desc, task, events, failures, halted)
+				// Each goroutine owns exactly one slot of the results, so no locking is required.
+				results[i] = res
+
+				// The slot frees up as soon as the host is done, regardless of how far along the output is.
+				<-sem
+				events <- hostLine{idx: i, hostname: h.Original, alias: h.Alias, result: res}
+			}(idx, hosts[idx])
+		}
+
+		wg.Wait()
+		close(events)
+	}()
+
+	// This blocks until every host of the batch has completed.
+	multiplex(ctx, out, events)
+}
+
+// runHost runs the task on a single host, unless the run was halted, interrupted or its deadline has passed in which
+// case the host is skipped. Any failure is tallied before returning, so the next host to start sees it.
+func runHost(ctx context.Context, idx int, host RemoteCmdHost, desc string, task hostTask, outputChan chan<- hostLine,
+	failures *atomic.Int32, halted func() bool) *RemoteCmdResult {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+
+	if ctx.Err() != nil {
+		return skippedResult(idx, host, context.Cause(ctx))
+	}
+	if halted() {
+		return skippedResult(idx, host, nil)
 	}
 
-	stderr, err := sshCmd.StderrPipe()
-	if err != nil {
-		return err
+	outputChan <- hostLine{idx: idx, hostname: host.Original, alias: host.Alias, started: true}
+
+	hostCtx := ctx
+	if cfg.CmdTimeout > 0 {
+		var cancel context.CancelFunc
+		hostCtx, cancel = context.WithTimeout(ctx, cfg.CmdTimeout)
+		defer cancel()
 	}
 
-	// Start the command
-	if err := sshCmd.Start(); err != nil {
-		return err
+	res := task(hostCtx, idx, host, outputChan)
+
+	// Whether it was this host's own timeout or the run's deadline, the host was killed for taking too long.
+	if !res.Success() && errors.Is(hostCtx.Err(), context.DeadlineExceeded) {
+		res.Status = StatusTimedOut
+	}
+	if !res.Success() && interrupted(hostCtx) {
+		res.Status = StatusInterrupted
 	}
 
-	// Read from the pipes
-	var wg sync.WaitGroup
-	wg.Add(2)
+	switch res.Status {
+	case StatusTimedOut:
+		// Timeouts still count towards halting a rollout, a hung host is hardly a healthy one.
+		failures.Add(1)
+		log.Warn(desc+" timed out", "host", host.Original, "elapsed", res.Elapsed().Round(time.Millisecond))
+	case StatusFailed:
+		failures.Add(1)
+		log.Error("error executing "+desc, "host", host.Original, "exitCode", res.ExitCode, "error", res.Err)
+	}
 
-	var emitStream = func(r io.Reader, isStdErr bool) {
-		defer wg.Done()
+	return res
+}
 
-		rdr := bufio.NewReader(r)
-		for {
-			line, err := rdr.ReadString('\n')
-			if err != nil {
-				if err != io.EOF {
-					log.Error("error occurred on reading from the stream", "error", err)
-				}
-				break
-			}
+// multiplex hands every event off to the output as it arrives until the channel is closed. A host's lines always
+// arrive in-between its start and its completion, as all of them are sent from the goroutine running that host.
+func multiplex(ctx context.Context, out remoteOutput, events <-chan hostLine) {
+	for hl := range events {
+		switch {
+		case hl.started:
+			out.hostStarted(ctx, hl.idx)
+		case hl.result != nil:
+			out.hostDone(ctx, hl.result)
+		default:
+			out.line(ctx, hl)
+		}
+	}
+}
 
-			outputChan <- hostLine{
-				idx:      idx,
-				hostname: host,
-				alias:    alias,
-				line:     strings.TrimSuffix(line, "\n"),
-				stderr:   isStdErr,
-			}
+// skipHosts marks every host within the remaining batches as skipped, the reason is set when the run was cut short.
+func skipHosts(hosts []RemoteCmdHost, remaining [][]int, results RemoteCmdResults, reason error) {
+	for _, batch := range remaining {
+		for _, idx := range batch {
+			results[idx] = skippedResult(idx, hosts[idx], reason)
 		}
 	}
+}
 
-	// Ensure each stream is consumed via the magical goroutines.
-	go emitStream(stderr, true)
-	go emitStream(stdout, false)
+func skippedResult(idx int, host RemoteCmdHost, reason error) *RemoteCmdResult {
+	return &RemoteCmdResult{
+		Host:     host,
+		Idx:      idx,
+		Status:   StatusSkipped,
+		ExitCode: -1,
+		Err:      reason,
+	}
+}
 
-	// Ensure proper shutdown on an early signal. (Such as when tail -f is used to follow a log file)
-	var sigKilled atomic.Bool
-	go func(remoteCmd *exec.Cmd) {
-		// Channel to receive OS signals
-		signals := make(chan os.Signal, 1)
+// failedResult is the result of a host which failed before anything could run on it.
+func failedResult(idx int, host RemoteCmdHost, err error) *RemoteCmdResult {
+	now := time.Now()
+	return &RemoteCmdResult{
+		Host:      host,
+		Idx:       idx,
+		Status:    StatusFailed,
+		ExitCode:  -1,
+		StartTime: now,
+		EndTime:   now,
+		Err:       err,
+	}
+}
 
-		// Register the channel to receive interrupt signal
-		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+// executeRemoteCmd runs the remote command on a single host, emitting each line of output on outputChan as it arrives.
+// The returned result is never nil.
+func executeRemoteCmd(ctx context.Context, executor RemoteExecutor, idx int, host RemoteCmdHost, remoteCmd string,
+	outputChan chan<- hostLine) *RemoteCmdResult {
+	return runExec(ctx, executor, idx, host, ExecRequest{Cmd: remoteCmd, Tty: true}, outputChan)
+}
 
-		<-signals
+// runExec runs the request on the host via the executor. Each line of stdout and stderr is emitted on outputChan and
+// captured in full for the result. When req.Stdout is already provided the raw
+// stdout stream is written there instead. The returned result is never nil.
+func runExec(ctx context.Context, executor RemoteExecutor, idx int, host RemoteCmdHost, req ExecRequest,
+	outputChan chan<- hostLine) *RemoteCmdResult {
+	res := &RemoteCmdResult{
+		Host:      host,
+		Idx:       idx,
+		StartTime: time.Now(),
+	}
 
-		fmt.Println()
-		log.Warn("SIGTERM received, closing remote command...")
+	stdout := &lineEmitter{idx: idx, host: host, out: outputChan}
+	stderr := &lineEmitter{idx: idx, host: host, stderr: true, out: outputChan}
+	if req.Stdout == nil {
+		req.Stdout = stdout
+	}
+	req.Stderr = stderr
+	req.Tags = host.Tags()
 
-		// Send the interrupt signal to the SSH process
-		if err := remoteCmd.Process.Signal(os.Interrupt); err != nil {
-			log.Error("error sending interrupt signal to remote command", "error", err)
-		}
+	exitCode, err := executor.Exec(ctx, host.Original, &req)
 
-		// Indicate we were killed via a signal.
-		sigKilled.Store(true)
-	}(sshCmd)
+	// A trailing line without a newline still counts.
+	stdout.flush()
+	stderr.flush()
 
-	wg.Wait()
+	res.EndTime = time.Now()
+	res.ExitCode = exitCode
+	res.Stdout = stdout.captured.Bytes()
+	res.Stderr = stderr.captured.Bytes()
 
-	// Wait for the command to finish, if we were killed prematurely via a signal, that's not an error
-	// we care to report to the user.
-	if err := sshCmd.Wait(); err != nil && !sigKilled.Load() {
-		return err
+	if err != nil {
+		res.Status = StatusFailed
+		res.Err = err
 	}
 
-	return nil
+	return res
 }
 
-func poll(ctx context.Context, w io.Writer, sem <-chan struct{}, allCompletions []*chanCompletions) {
-	cfg := CtxAsConfig(ctx, CtxKeyConfig)
-	var totalCompleted int
+// lineEmitter is an io.Writer which captures everything written to it and emits every complete line as a hostLine.
+type lineEmitter struct {
+	idx      int
+	host     RemoteCmdHost
+	stderr   bool
+	out      chan<- hostLine
+	captured bytes.Buffer
+	pending  []byte
+}
+
+func (e *lineEmitter) Write(p []byte) (int, error) {
+	e.captured.Write(p)
+	e.pending = append(e.pending, p...)
 
-	// Loop indefinitely until all totalCompleted are accounted for, then bail.
 	for {
-		if totalCompleted == len(allCompletions) {
-			// We're completely done, so return.
-			return
+		i := bytes.IndexByte(e.pending, '\n')
+		if i < 0 {
+			break
 		}
+		e.emit(string(e.pending[:i]))
+		e.pending = e.pending[i+1:]
+	}
 
-		// Continually iterate through all completions and check that the following conditions:
-		// 1. If we're completed for the first time, coordinate shutdown of this completion.
-		// 2. If we're already completed, just skip
-		// 3. Otherwise, if we're not completed consume up to maxLinesToProcess lines before moving onto the next
-		// channel. We do this to best-effort cluster the output.
-
-		for _, comp := range allCompletions {
-		nextCompletion:
-			// Attempt to read n lines from the channel before trying the next one, assuming they're ready.
-			// This is intended to minimize the interleaving of lines across hosts.
-			for i := 0; i < maxLinesToCluster; i++ {
-				select {
-				case stream, isOpen := <-comp.ch:
-					if !isOpen && !comp.completed {
-						// Mark this completion as done!
-						comp.completed = true
-
-						// Track how many completions are done.
-						totalCompleted++
-
-						// Mark sem for letting more work come in.
-						<-sem
-
-						// This completion is complete, move on to the next non-closed completion.
-						break nextCompletion
-					} else if comp.completed {
-						// We've already drained this to completion, our work is done so skip.
-						break nextCompletion
-					}
-
-					if stream.stderr {
-						if cfg.Stderr {
-							// Optionally render stderr when requested.
-							RenderLogLine(ctx, w, stream.idx, stream.stderr, stream.hostname, stream.alias, stream.line)
-						}
-					} else {
-						// Always render stdout.
-						RenderLogLine(ctx, w, stream.idx, stream.stderr, stream.hostname, stream.alias, stream.line)
-					}
-				case <-time.After(maxCompletionTimeout):
-					// We've waited long enough maybe another completion is ready.
-					break nextCompletion
-				}
-			}
-		}
+	return len(p), nil
+}
+
+// flush emits whatever partial line remains.
+func (e *lineEmitter) flush() {
+	if len(e.pending) > 0 {
+		e.emit(string(e.pending))
+		e.pending = nil
+	}
+}
+
+func (e *lineEmitter) emit(line string) {
+	e.out <- hostLine{
+		idx:      e.idx,
+		hostname: e.host.Original,
+		alias:    e.host.Alias,
+		line:     line,
+		stderr:   e.stderr,
+		ts:       time.Now(),
 	}
 }
@@ -0,0 +1,374 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeSSH returns an ssh executor backed by a shell script that ignores the host and any -t flags and simply runs
+// the remote command locally.
+func newFakeSSH(t *testing.T) RemoteExecutor {
+	t.Helper()
+
+	fakeSSH := filepath.Join(t.TempDir(), "fakessh")
+	script := "#!/bin/sh\nshift\nwhile [ \"$1\" = \"-t\" ]; do shift; done\nexec /bin/sh -c \"$1\"\n"
+	assert.NoError(t, os.WriteFile(fakeSSH, []byte(script), 0755))
+
+	return NewSSHExecutor(fakeSSH, SSHSettings{})
+}
+
+// fakeExecutor runs every request through the provided func, it never touches the network or forks processes.
+type fakeExecutor struct {
+	exec func(ctx context.Context, host string, req *ExecRequest) (int, error)
+}
+
+func (f *fakeExecutor) Name() string {
+	return "fake"
+}
+
+func (f *fakeExecutor) Describe(host string, req *ExecRequest) string {
+	return "fake " + host + " " + req.Cmd
+}
+
+func (f *fakeExecutor) Exec(ctx context.Context, host string, req *ExecRequest) (int, error) {
+	return f.exec(ctx, host, req)
+}
+
+func TestRemoteCmdResults(t *testing.T) {
+	results := RemoteCmdResults{
+		{Idx: 0, Status: StatusSucceeded, ExitCode: 0},
+		{Idx: 1, Status: StatusFailed, ExitCode: 3},
+		{Idx: 2, Status: StatusFailed, ExitCode: -1, Err: errors.New("no binary exists for this os")},
+		{Idx: 3, Status: StatusSucceeded, ExitCode: 0},
+		{Idx: 4, Status: StatusSkipped, ExitCode: -1},
+		{Idx: 5, Status: StatusTimedOut, ExitCode: -1},
+	}
+
+	assert.Equal(t, 2, results.Successes())
+
+	failed := results.Failed()
+	assert.Len(t, failed, 2)
+	assert.Equal(t, 1, failed[0].Idx)
+	assert.Equal(t, 2, failed[1].Idx)
+
+	unsuccessful := results.Unsuccessful()
+	assert.Len(t, unsuccessful, 3)
+	assert.Equal(t, 5, unsuccessful[2].Idx)
+
+	assert.Equal(t, RemoteCmdSummary{Successes: 2, Failures: 2, Skipped: 1, TimedOut: 1, Elapsed: time.Second},
+		results.Summary(time.Second))
+}
+
+func TestExecuteClusterRemoteCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ssh requires a posix shell")
+	}
+	executor := newFakeSSH(t)
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 2
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{
+		{Original: "foo"},
+		{Original: "bar"},
+		{Original: "baz"},
+	}
+
+	var b bytes.Buffer
+	results := ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "echo hello; echo oops 1>&2; exit 7")
+
+	assert.Len(t, results, len(hosts))
+	assert.Equal(t, 0, results.Successes())
+	assert.Len(t, results.Failed(), len(hosts))
+
+	for idx, res := range results {
+		assert.Equal(t, idx, res.Idx)
+		assert.Equal(t, hosts[idx], res.Host)
+		assert.Equal(t, 7, res.ExitCode)
+		assert.Error(t, res.Err)
+		assert.Equal(t, "hello\n", string(res.Stdout))
+		assert.Equal(t, "oops\n", string(res.Stderr))
+		assert.False(t, res.EndTime.Before(res.StartTime))
+	}
+
+	assert.Contains(t, b.String(), "foo >1 (0): hello")
+	assert.Contains(t, b.String(), "Finished: successes: 0, failures: 3")
+}
+
+func TestExecuteClusterRemoteCmdRollout(t *testing.T) {
+	// The remote command is simply the exit code every host returns.
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		if req.Cmd == "true" {
+			return 0, nil
+		}
+		return 1, errors.New("exit status 1")
+	}}
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 1
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{
+		{Original: "a"}, {Original: "b"}, {Original: "c"}, {Original: "d"}, {Original: "e"},
+	}
+
+	// Every host fails, so after 2 failures nothing else should start.
+	cfgCtx.Rollout = RolloutStrategy{Batch: BatchSize{Count: 1}, MaxFailures: 2}
+
+	var b bytes.Buffer
+	results := ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "false")
+	assert.Len(t, results.Failed(), 2)
+	assert.Len(t, results.WithStatus(StatusSkipped), 3)
+	assert.Contains(t, b.String(), "skipped: 3")
+
+	// A failed canary halts everything after it.
+	cfgCtx.Rollout = RolloutStrategy{Batch: BatchSize{Percent: 50}, Canary: 1}
+
+	b.Reset()
+	results = ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "false")
+	assert.Equal(t, StatusFailed, results[0].Status)
+	assert.Len(t, results.WithStatus(StatusSkipped), 4)
+
+	// A healthy canary lets the rollout carry on to completion.
+	b.Reset()
+	results = ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "true")
+	assert.Equal(t, len(hosts), results.Successes())
+}
+
+func TestExecuteClusterRemoteCmdOutput(t *testing.T) {
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		assert.True(t, req.Tty, "remote commands always request a tty")
+		// Writes don't need to line up with lines and the last line may lack a newline.
+		_, _ = io.WriteString(req.Stdout, "hello from ")
+		_, _ = io.WriteString(req.Stdout, host+"\nbye")
+		_, _ = io.WriteString(req.Stderr, "warning\n")
+		return 0, nil
+	}}
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 5
+	cfgCtx.Stderr = true
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	var b bytes.Buffer
+	results := ExecuteClusterRemoteCmd(ctx, &b, executor, []RemoteCmdHost{{Original: "foo"}}, "whatever")
+	assert.Equal(t, 1, results.Successes())
+	assert.Equal(t, "hello from foo\nbye", string(results[0].Stdout))
+	assert.Equal(t, "warning\n", string(results[0].Stderr))
+
+	out := b.String()
+	assert.Contains(t, out, "foo >1 (0): hello from foo\n")
+	assert.Contains(t, out, "foo >1 (0): bye\n")
+	assert.Contains(t, out, "foo >2 (0): warning\n")
+}
+
+func TestExecuteClusterRemoteCmdTimeouts(t *testing.T) {
+	// Hosts named slow hang until they're killed via the context.
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		if host == "slow" {
+			<-ctx.Done()
+			return -1, ctx.Err()
+		}
+		if host == "broken" {
+			return 1, errors.New("exit status 1")
+		}
+		return 0, nil
+	}}
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 5
+	cfgCtx.CmdTimeout = time.Millisecond * 50
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{{Original: "fast"}, {Original: "slow"}, {Original: "broken"}}
+
+	var b bytes.Buffer
+	results := ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "whatever")
+	assert.Equal(t, StatusSucceeded, results[0].Status)
+	assert.Equal(t, StatusTimedOut, results[1].Status)
+	assert.Equal(t, StatusFailed, results[2].Status)
+	assert.Contains(t, b.String(), "failures: 1, timed out: 1")
+
+	// The deadline kills what's running and skips whatever hasn't started yet.
+	cfgCtx.CmdTimeout = 0
+	cfgCtx.Deadline = time.Millisecond * 50
+	cfgCtx.Concurrency = 1
+
+	b.Reset()
+	// With a concurrency of 1 whichever host starts first hangs until the deadline, the other never starts.
+	results = ExecuteClusterRemoteCmd(ctx, &b, executor, []RemoteCmdHost{{Original: "slow"}, {Original: "slow"}}, "whatever")
+	assert.Len(t, results.WithStatus(StatusTimedOut), 1)
+	assert.Len(t, results.WithStatus(StatusSkipped), 1)
+	assert.Len(t, results.Unsuccessful(), 2, "a host the deadline kept from starting didn't succeed either")
+}
+
+func TestExecuteClusterRemoteCmdDeadlineDuringPause(t *testing.T) {
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		return 0, nil
+	}}
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 1
+	cfgCtx.Deadline = time.Millisecond * 50
+	cfgCtx.Rollout = RolloutStrategy{Batch: BatchSize{Count: 1}, Pause: time.Second * 5}
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{{Original: "a"}, {Original: "b"}, {Original: "c"}}
+
+	var b bytes.Buffer
+	startTime := time.Now()
+	results := ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "whatever")
+
+	assert.Less(t, time.Since(startTime), time.Second, "the deadline cuts the pause short")
+	assert.Equal(t, StatusSucceeded, results[0].Status)
+	assert.Equal(t, StatusSkipped, results[1].Status)
+	assert.ErrorIs(t, results[1].Err, ErrDeadlineReached)
+
+	// Nothing failed as such, yet the run is unsuccessful as most of the fleet never ran.
+	assert.Len(t, results.Failed(), 0)
+	assert.Len(t, results.CutShort(), 2)
+	assert.Len(t, results.Unsuccessful(), 2)
+}
+
+func TestExecuteClusterRemoteCmdKillsHungProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ssh requires a posix shell")
+	}
+	executor := newFakeSSH(t)
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 1
+	cfgCtx.CmdTimeout = time.Millisecond * 100
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	var b bytes.Buffer
+	startTime := time.Now()
+	results := ExecuteClusterRemoteCmd(ctx, &b, executor, []RemoteCmdHost{{Original: "foo"}}, "exec sleep 30")
+	assert.Equal(t, StatusTimedOut, results[0].Status)
+	assert.Less(t, time.Since(startTime), time.Second*10)
+}
+
+// latencyOutput records how long each line took from being emitted by a host to reaching the output.
+type latencyOutput struct {
+	latencies []time.Duration
+	completed int
+}
+
+func (l *latencyOutput) hostStarted(ctx context.Context, idx int) {}
+
+func (l *latencyOutput) line(ctx context.Context, hl hostLine) {
+	l.latencies = append(l.latencies, time.Since(hl.ts))
+}
+
+func (l *latencyOutput) hostDone(ctx context.Context, res *RemoteCmdResult) {
+	l.completed++
+}
+
+func (l *latencyOutput) finish(ctx context.Context, results RemoteCmdResults) {}
+
+// BenchmarkExecuteBatch simulates large fan-outs where every host runs for a millisecond and emits a handful of lines.
+// Besides the wall time it reports the cpu time per run, where supported, along with the p50 and p99 latency of a line reaching the
+// output.
+func BenchmarkExecuteBatch(b *testing.B) {
+	const (
+		linesPerHost = 10
+		concurrency  = 100
+	)
+
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		time.Sleep(time.Millisecond)
+		for i := 0; i < linesPerHost; i++ {
+			_, _ = io.WriteString(req.Stdout, "a line of output\n")
+		}
+		return 0, nil
+	}}
+
+	for _, numHosts := range []int{1000, 5000} {
+		b.Run(fmt.Sprintf("hosts=%d", numHosts), func(b *testing.B) {
+			cfgCtx := NewConfigCtx()
+			cfgCtx.Concurrency = concurrency
+			ctx := context.WithValue(context.Background(), CtxKeyConfig, cfgCtx)
+
+			hosts := make([]RemoteCmdHost, numHosts)
+			batch := make([]int, numHosts)
+			for i := range hosts {
+				hosts[i] = RemoteCmdHost{Original: fmt.Sprintf("host-%04d", i)}
+				batch[i] = i
+			}
+
+			task := func(ctx context.Context, idx int, host RemoteCmdHost, outputChan chan<- hostLine) *RemoteCmdResult {
+				return runExec(ctx, executor, idx, host, ExecRequest{Cmd: "bench"}, outputChan)
+			}
+
+			var latencies []time.Duration
+			startCPU, hasCPU := cpuTime()
+			b.ResetTimer()
+
+			for n := 0; n < b.N; n++ {
+				var failures atomic.Int32
+				out := &latencyOutput{}
+				executeBatch(ctx, out, hosts, batch, "bench", task, make(RemoteCmdResults, numHosts), &failures,
+					func() bool { return false })
+
+				if out.completed != numHosts || len(out.latencies) != numHosts*linesPerHost {
+					b.Fatalf("expected %d hosts and %d lines, got: %d and %d", numHosts, numHosts*linesPerHost,
+						out.completed, len(out.latencies))
+				}
+				latencies = append(latencies, out.latencies...)
+			}
+
+			b.StopTimer()
+			if endCPU, ok := cpuTime(); hasCPU && ok {
+				b.ReportMetric(float64(endCPU-startCPU)/float64(b.N), "cpu-ns/op")
+			}
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)/2].Microseconds()), "p50-latency-µs")
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Microseconds()), "p99-latency-µs")
+		})
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/deckarep/tips/pkg/utils"
+)
+
+// ExecuteClusterCopy uploads the local file or directory into remoteDir on every host. The upload is streamed as a tar
+// archive through the same executor used for remote commands, so it works wherever a remote command works and only
+// requires tar to be present on the remote host. It shares the concurrency, rollout and summary of remote commands.
+func ExecuteClusterCopy(ctx context.Context, w io.Writer, executor RemoteExecutor, hosts []RemoteCmdHost,
+	localPath, remoteDir string) RemoteCmdResults {
+	// Extract in place, creating the destination when it doesn't yet exist.
+	quotedDir := utils.ShellQuote(remoteDir)
+	remoteCmd := fmt.Sprintf("mkdir -p %s && tar -xf - -C %s", quotedDir, quotedDir)
+
+	return executeCluster(ctx, w, hosts, fmt.Sprintf("copy of %s to %s", localPath, remoteDir),
+		func(ctx context.Context, idx int, host RemoteCmdHost, outputChan chan<- hostLine) *RemoteCmdResult {
+			// Every host gets its own archive stream, produced on the fly.
+			pr, pw := io.Pipe()
+			go func() {
+				pw.CloseWithError(writeTarArchive(pw, localPath))
+			}()
+
+			res := runExec(ctx, executor, idx, host, ExecRequest{Cmd: remoteCmd, Stdin: pr}, outputChan)
+
+			// Should ssh bail early, this unblocks the archive writer.
+			pr.Close()
+			return res
+		},
+		func(ctx context.Context, idx int, host RemoteCmdHost) (string, error) {
+			return executor.Describe(host.Original, &ExecRequest{Cmd: remoteCmd, Tags: host.Tags()}) + " < tar of " + localPath, nil
+		})
+}
+
+// ExecuteClusterPull fetches the remote file or directory from every host into a local directory tree keyed by the
+// machine name: <localDir>/<machine>/<base name of remotePath>. Just like ExecuteClusterCopy it's streamed as a tar
+// archive through the executor and shares the concurrency, rollout and summary of remote commands.
+func ExecuteClusterPull(ctx context.Context, w io.Writer, executor RemoteExecutor, hosts []RemoteCmdHost,
+	remotePath, localDir string) RemoteCmdResults {
+	// Remote hosts are always treated as posix.
+	remotePath = path.Clean(remotePath)
+	remoteCmd := fmt.Sprintf("tar -cf - -C %s %s",
+		utils.ShellQuote(path.Dir(remotePath)), utils.ShellQuote(path.Base(remotePath)))
+
+	return executeCluster(ctx, w, hosts, fmt.Sprintf("pull of %s to %s", remotePath, localDir),
+		func(ctx context.Context, idx int, host RemoteCmdHost, outputChan chan<- hostLine) *RemoteCmdResult {
+			hostDir := filepath.Join(localDir, hostDirName(host))
+
+			// The archive is extracted as it streams in.
+			pr, pw := io.Pipe()
+			extracted := make(chan error, 1)
+			go func() {
+				err := extractTarArchive(pr, hostDir)
+				if err == nil {
+					// Drain the record padding tar leaves after the end of the archive.
+					_, _ = io.Copy(io.Discard, pr)
+				}
+				// On a failed extraction, closing with the error makes ssh bail rather than block forever.
+				pr.CloseWithError(err)
+				extracted <- err
+			}()
+
+			res := runExec(ctx, executor, idx, host, ExecRequest{Cmd: remoteCmd, Stdout: pw}, outputChan)
+			pw.Close()
+
+			if err := <-extracted; err != nil && res.Success() {
+				res.Status = StatusFailed
+				res.ExitCode = -1
+				res.Err = err
+			}
+			return res
+		},
+		func(ctx context.Context, idx int, host RemoteCmdHost) (string, error) {
+			hostDir := filepath.Join(localDir, hostDirName(host))
+			return executor.Describe(host.Original, &ExecRequest{Cmd: remoteCmd, Tags: host.Tags()}) + " > untar into " + hostDir, nil
+		})
+}
+
+// hostDirName is the local directory name used for a host, it's the machine name shown to the user.
+func hostDirName(host RemoteCmdHost) string {
+	// Never let a name escape the local output directory.
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(hostDisplayName(host))
+}
+
+// writeTarArchive writes the file or directory at srcPath as a tar archive to w. Entries are named relative to the
+// parent of srcPath, so copying "./conf" produces "conf/..." entries.
+func writeTarArchive(w io.Writer, srcPath string) error {
+	srcPath = filepath.Clean(srcPath)
+	baseDir := filepath.Dir(srcPath)
+
+	tw := tar.NewWriter(w)
+
+	err := filepath.WalkDir(srcPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(relPath)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		// Only regular files have a body.
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// extractTarArchive extracts the tar archive read from r into destDir, which is created when missing. Only
+// directories and regular files are extracted and any entry that would land outside of destDir is an error.
+func extractTarArchive(r io.Reader, destDir string) error {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(destDir, filepath.FromSlash(hdr.Name))
+		if rel, err := filepath.Rel(destDir, target); err != nil || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return errors.New("refusing to extract archive entry outside of destination: " + hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := writeFileFrom(target, tr, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		default:
+			// Links, devices and the like are deliberately skipped.
+		}
+	}
+}
+
+func writeFileFrom(target string, r io.Reader, perm fs.FileMode) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
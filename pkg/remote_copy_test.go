@@ -0,0 +1,175 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTree creates a small directory tree to be copied around.
+func makeTree(t *testing.T) string {
+	t.Helper()
+
+	src := filepath.Join(t.TempDir(), "conf")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "sites"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "nginx.conf"), []byte("worker_processes 4;\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "sites", "default"), []byte("listen 80;\n"), 0644))
+	return src
+}
+
+func TestWriteTarArchive(t *testing.T) {
+	src := makeTree(t)
+
+	var b bytes.Buffer
+	assert.NoError(t, writeTarArchive(&b, src))
+
+	contents := make(map[string]string)
+	tr := tar.NewReader(&b)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+
+		body, err := io.ReadAll(tr)
+		assert.NoError(t, err)
+		contents[hdr.Name] = string(body)
+	}
+
+	assert.Equal(t, map[string]string{
+		"conf":               "",
+		"conf/nginx.conf":    "worker_processes 4;\n",
+		"conf/sites":         "",
+		"conf/sites/default": "listen 80;\n",
+	}, contents)
+
+	// A single file is archived by its base name.
+	b.Reset()
+	assert.NoError(t, writeTarArchive(&b, filepath.Join(src, "nginx.conf")))
+	hdr, err := tar.NewReader(&b).Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "nginx.conf", hdr.Name)
+}
+
+func TestExecuteClusterCopy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ssh requires a posix shell")
+	}
+	executor := newFakeSSH(t)
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 2
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	src := makeTree(t)
+	// The fake ssh runs locally, so every host extracts into the same directory.
+	dst := filepath.Join(t.TempDir(), "remote dir")
+
+	var b bytes.Buffer
+	results := ExecuteClusterCopy(ctx, &b, executor, []RemoteCmdHost{{Original: "foo"}, {Original: "bar"}}, src, dst)
+	assert.Equal(t, 2, results.Successes())
+
+	body, err := os.ReadFile(filepath.Join(dst, "conf", "sites", "default"))
+	assert.NoError(t, err)
+	assert.Equal(t, "listen 80;\n", string(body))
+
+	// A failure on the remote side is reported per host.
+	blocker := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(blocker, nil, 0644))
+
+	results = ExecuteClusterCopy(ctx, &b, executor, []RemoteCmdHost{{Original: "foo"}}, src, filepath.Join(blocker, "nested"))
+	assert.Len(t, results.Failed(), 1)
+}
+
+func TestExecuteClusterPull(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ssh requires a posix shell")
+	}
+	executor := newFakeSSH(t)
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 2
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	src := makeTree(t)
+	out := filepath.Join(t.TempDir(), "out")
+	hosts := []RemoteCmdHost{{Original: "foo"}, {Original: "blade", Alias: "bar"}}
+
+	var b bytes.Buffer
+	results := ExecuteClusterPull(ctx, &b, executor, hosts, filepath.Join(src, "nginx.conf"), out)
+	assert.Equal(t, 2, results.Successes())
+
+	// Each host lands in its own directory keyed by the machine name.
+	for _, machine := range []string{"foo", "bar"} {
+		body, err := os.ReadFile(filepath.Join(out, machine, "nginx.conf"))
+		assert.NoError(t, err)
+		assert.Equal(t, "worker_processes 4;\n", string(body))
+	}
+
+	// Whole directories work too.
+	results = ExecuteClusterPull(ctx, &b, executor, hosts[:1], src+"/", out)
+	assert.Equal(t, 1, results.Successes())
+	body, err := os.ReadFile(filepath.Join(out, "foo", "conf", "sites", "default"))
+	assert.NoError(t, err)
+	assert.Equal(t, "listen 80;\n", string(body))
+
+	// A missing remote path is a per-host failure.
+	results = ExecuteClusterPull(ctx, &b, executor, hosts[:1], filepath.Join(src, "nope.log"), out)
+	assert.Len(t, results.Failed(), 1)
+}
+
+func TestExtractTarArchive(t *testing.T) {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "../escape.txt", Mode: 0644, Size: 2, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte("hi"))
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+
+	dst := t.TempDir()
+	assert.Error(t, extractTarArchive(&b, filepath.Join(dst, "out")))
+
+	_, err = os.Stat(filepath.Join(dst, "escape.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestHostDirName(t *testing.T) {
+	assert.Equal(t, "foo", hostDirName(RemoteCmdHost{Original: "foo"}))
+	assert.Equal(t, "bar", hostDirName(RemoteCmdHost{Original: "blade", Alias: "bar"}))
+	assert.Equal(t, "__etc_passwd", hostDirName(RemoteCmdHost{Original: "../etc/passwd"}))
+}
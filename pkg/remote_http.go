@@ -0,0 +1,228 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HTTPTargetIPv4 addresses hosts by their Tailscale IPv4 address.
+	HTTPTargetIPv4 = "ipv4"
+	// HTTPTargetDNS addresses hosts by their MagicDNS name.
+	HTTPTargetDNS = "dns"
+
+	// httpDefaultTimeout applies to each request when no --cmd_timeout was given.
+	httpDefaultTimeout = time.Second * 10
+	// httpMaxBody is the most of a response body that's ever read.
+	httpMaxBody = 1 << 20
+	// httpBodyExcerpt is how much of the body is shown unless the full body was asked for.
+	httpBodyExcerpt = 120
+)
+
+// HTTPRequestSpec is the request made against every host, only the host part of the url differs per host.
+type HTTPRequestSpec struct {
+	Method string
+	Scheme string
+	// Port is optional, the default port of the scheme applies when empty.
+	Port string
+	Path string
+}
+
+// ParseHTTPRequest parses a target such as ":8080/healthz", "/status" or "https://:8443/metrics?x=1". The host part
+// is always left out, as it's filled in for every host.
+func ParseHTTPRequest(method, target string) (*HTTPRequestSpec, error) {
+	spec := &HTTPRequestSpec{Method: strings.ToUpper(strings.TrimSpace(method)), Scheme: "http"}
+	if len(spec.Method) == 0 {
+		return nil, fmt.Errorf("an http method such as GET is required")
+	}
+
+	rest := strings.TrimSpace(target)
+	for _, scheme := range []string{"http", "https"} {
+		if strings.HasPrefix(rest, scheme+"://") {
+			spec.Scheme = scheme
+			rest = strings.TrimPrefix(rest, scheme+"://")
+		}
+	}
+
+	if strings.HasPrefix(rest, ":") {
+		port, path, _ := strings.Cut(rest[1:], "/")
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return nil, fmt.Errorf("invalid port in http target: %q", target)
+		}
+		spec.Port = port
+		rest = "/" + path
+	}
+
+	if !strings.HasPrefix(rest, "/") {
+		return nil, fmt.Errorf("invalid http target: %q, expected a port and/or path such as :8080/healthz", target)
+	}
+	spec.Path = rest
+
+	return spec, nil
+}
+
+// URL returns the url of the request against the host.
+func (s *HTTPRequestSpec) URL(host string) string {
+	if len(s.Port) > 0 {
+		host = net.JoinHostPort(host, s.Port)
+	} else if strings.Contains(host, ":") {
+		// A bare IPv6 address still needs its brackets.
+		host = "[" + host + "]"
+	}
+	return s.Scheme + "://" + host + s.Path
+}
+
+func (s *HTTPRequestSpec) String() string {
+	port := ""
+	if len(s.Port) > 0 {
+		port = ":" + s.Port
+	}
+	return fmt.Sprintf("%s %s://%s%s", s.Method, s.Scheme, port, s.Path)
+}
+
+// httpHostAddress returns the address the host is reached at, which is either its IPv4 address or its MagicDNS name.
+// Without a device the host's name is all there is.
+func httpHostAddress(host RemoteCmdHost, target string) string {
+	if host.Device == nil {
+		return host.Original
+	}
+
+	switch target {
+	case HTTPTargetDNS:
+		if len(host.Device.Name) > 0 {
+			return host.Device.Name
+		}
+	default:
+		// The first address of a device is its IPv4 address.
+		if len(host.Device.Addresses) > 0 {
+			return host.Device.Addresses[0]
+		}
+	}
+
+	return host.Original
+}
+
+// ValidateHTTPTarget returns an error when target is not one of the supported ways of addressing hosts.
+func ValidateHTTPTarget(target string) error {
+	switch target {
+	case HTTPTargetIPv4, HTTPTargetDNS:
+		return nil
+	}
+	return fmt.Errorf("unknown http target: %q, expected one of: %s or %s", target, HTTPTargetIPv4, HTTPTargetDNS)
+}
+
+// ExecuteClusterHTTP makes the request against every host, straight from this machine over the tailnet. Each host
+// reports the status code and latency, followed by an excerpt of the body or the full body when fullBody is set. A
+// status code of 400 or above fails the host, its status code then doubles as the exit code. It shares the
+// concurrency, rollout and summary of remote commands.
+func ExecuteClusterHTTP(ctx context.Context, w io.Writer, client *http.Client, hosts []RemoteCmdHost,
+	spec *HTTPRequestSpec, target string, fullBody bool) RemoteCmdResults {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+
+	if client.Timeout == 0 && cfg.CmdTimeout == 0 {
+		c := *client
+		c.Timeout = httpDefaultTimeout
+		client = &c
+	}
+
+	return executeCluster(ctx, w, hosts, "http request: "+spec.String(),
+		func(ctx context.Context, idx int, host RemoteCmdHost, outputChan chan<- hostLine) *RemoteCmdResult {
+			return doHTTPRequest(ctx, client, idx, host, spec.URL(httpHostAddress(host, target)), spec.Method,
+				fullBody, outputChan)
+		},
+		func(ctx context.Context, idx int, host RemoteCmdHost) (string, error) {
+			return spec.Method + " " + spec.URL(httpHostAddress(host, target)), nil
+		})
+}
+
+func doHTTPRequest(ctx context.Context, client *http.Client, idx int, host RemoteCmdHost, url, method string,
+	fullBody bool, outputChan chan<- hostLine) *RemoteCmdResult {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return failedResult(idx, host, err)
+	}
+
+	res := &RemoteCmdResult{
+		Host:      host,
+		Idx:       idx,
+		StartTime: time.Now(),
+	}
+	stdout := &lineEmitter{idx: idx, host: host, out: outputChan}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		res.EndTime = time.Now()
+		res.Status = StatusFailed
+		res.ExitCode = -1
+		res.Err = err
+		return res
+	}
+	defer resp.Body.Close()
+	// The latency is up to the response headers, the body's transfer only counts towards the host's elapsed time.
+	latency := time.Since(res.StartTime)
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, httpMaxBody))
+	res.EndTime = time.Now()
+
+	fmt.Fprintf(stdout, "HTTP %s in %s\n", resp.Status, latency.Round(time.Millisecond))
+	if fullBody {
+		stdout.Write(body)
+	} else if excerpt := httpExcerpt(body); len(excerpt) > 0 {
+		fmt.Fprintln(stdout, excerpt)
+	}
+	stdout.flush()
+	res.Stdout = stdout.captured.Bytes()
+
+	switch {
+	case err != nil:
+		res.Status = StatusFailed
+		res.ExitCode = -1
+		res.Err = err
+	case resp.StatusCode >= 400:
+		res.Status = StatusFailed
+		res.ExitCode = resp.StatusCode
+		res.Err = fmt.Errorf("http status: %s", resp.Status)
+	}
+
+	return res
+}
+
+// httpExcerpt squashes the start of the body into a single line.
+func httpExcerpt(body []byte) string {
+	excerpt := strings.Join(strings.Fields(string(body)), " ")
+	if runes := []rune(excerpt); len(runes) > httpBodyExcerpt {
+		excerpt = string(runes[:httpBodyExcerpt]) + "…"
+	}
+	return excerpt
+}
@@ -0,0 +1,146 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestParseHTTPRequest(t *testing.T) {
+	spec, err := ParseHTTPRequest("get", ":8080/healthz")
+	assert.NoError(t, err)
+	assert.Equal(t, &HTTPRequestSpec{Method: "GET", Scheme: "http", Port: "8080", Path: "/healthz"}, spec)
+	assert.Equal(t, "http://100.64.0.1:8080/healthz", spec.URL("100.64.0.1"))
+	assert.Equal(t, "GET http://:8080/healthz", spec.String())
+
+	spec, err = ParseHTTPRequest("HEAD", "https://:8443")
+	assert.NoError(t, err)
+	assert.Equal(t, &HTTPRequestSpec{Method: "HEAD", Scheme: "https", Port: "8443", Path: "/"}, spec)
+
+	spec, err = ParseHTTPRequest("GET", "/metrics?format=text")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://blade.tailnet.ts.net/metrics?format=text", spec.URL("blade.tailnet.ts.net"))
+	assert.Equal(t, "http://[fd7a:115c:a1e0::1]/metrics?format=text", spec.URL("fd7a:115c:a1e0::1"))
+
+	for _, target := range []string{"healthz", ":http/healthz", ":0/", ":70000/", "ftp://:21/"} {
+		_, err = ParseHTTPRequest("GET", target)
+		assert.Error(t, err, target)
+	}
+
+	_, err = ParseHTTPRequest(" ", ":8080/")
+	assert.Error(t, err, "a method is required")
+}
+
+func TestHTTPHostAddress(t *testing.T) {
+	host := RemoteCmdHost{Original: "blade", Device: &WrappedDevice{Device: tailscale.Device{
+		Name:      "blade.tailnet.ts.net",
+		Addresses: []string{"100.64.0.1", "fd7a:115c:a1e0::1"},
+	}}}
+
+	assert.Equal(t, "100.64.0.1", httpHostAddress(host, HTTPTargetIPv4))
+	assert.Equal(t, "blade.tailnet.ts.net", httpHostAddress(host, HTTPTargetDNS))
+
+	// Without a device there is only the name to go by.
+	assert.Equal(t, "blade", httpHostAddress(RemoteCmdHost{Original: "blade"}, HTTPTargetIPv4))
+
+	assert.NoError(t, ValidateHTTPTarget(HTTPTargetDNS))
+	assert.Error(t, ValidateHTTPTarget("ipv6"))
+}
+
+func TestExecuteClusterHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-body" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Second)
+			w.Write([]byte("done"))
+			return
+		}
+		if r.URL.Path == "/broken" {
+			http.Error(w, "on fire", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("{\n  \"status\": \"ok\",\n  \"checks\": " + strings.Repeat("1", 200) + "\n}\n"))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 2
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{
+		{Original: "a", Device: &WrappedDevice{Device: tailscale.Device{Addresses: []string{u.Hostname()}}}},
+		{Original: "b", Device: &WrappedDevice{Device: tailscale.Device{Addresses: []string{u.Hostname()}}}},
+	}
+
+	spec, err := ParseHTTPRequest("GET", ":"+u.Port()+"/healthz")
+	assert.NoError(t, err)
+
+	var b bytes.Buffer
+	results := ExecuteClusterHTTP(ctx, &b, srv.Client(), hosts, spec, HTTPTargetIPv4, false)
+	assert.Equal(t, 2, results.Successes())
+	assert.Contains(t, string(results[0].Stdout), "HTTP 200 OK in ")
+	assert.Contains(t, string(results[0].Stdout), `{ "status": "ok", "checks": 111`)
+	assert.Contains(t, string(results[0].Stdout), "…", "long bodies are cut short")
+
+	// The full body is only printed when asked for.
+	results = ExecuteClusterHTTP(ctx, &b, srv.Client(), hosts[:1], spec, HTTPTargetIPv4, true)
+	assert.Contains(t, string(results[0].Stdout), "\n  \"status\": \"ok\",\n")
+
+	// The latency doesn't include a slow body, which only counts towards the host's elapsed time.
+	spec.Path = "/slow-body"
+	results = ExecuteClusterHTTP(ctx, &b, srv.Client(), hosts[:1], spec, HTTPTargetIPv4, false)
+	assert.GreaterOrEqual(t, results[0].Elapsed(), time.Second)
+	assert.NotRegexp(t, `HTTP 200 OK in [1-9][0-9.]*s\n`, string(results[0].Stdout))
+
+	// An error status fails the host, with the status code as its exit code.
+	spec.Path = "/broken"
+	results = ExecuteClusterHTTP(ctx, &b, srv.Client(), hosts, spec, HTTPTargetIPv4, false)
+	assert.Len(t, results.Failed(), 2)
+	assert.Equal(t, http.StatusServiceUnavailable, results[0].ExitCode)
+	assert.Contains(t, string(results[0].Stdout), "on fire")
+
+	// So does a host which can't be reached at all.
+	srv.Close()
+	results = ExecuteClusterHTTP(ctx, &b, srv.Client(), hosts[:1], spec, HTTPTargetIPv4, false)
+	assert.Len(t, results.Failed(), 1)
+	assert.Equal(t, -1, results[0].ExitCode)
+	assert.Error(t, results[0].Err)
+}
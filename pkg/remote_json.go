@@ -0,0 +1,198 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/charmbracelet/log"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// JSONLineEvent is emitted for every line of output of a host.
+type JSONLineEvent struct {
+	Type   string    `json:"type"`
+	Idx    int       `json:"idx"`
+	Host   string    `json:"host"`
+	Alias  string    `json:"alias,omitempty"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"line"`
+	Time   time.Time `json:"ts"`
+}
+
+// JSONSummaryEvent is the last event of a run, tallying the hosts by status.
+type JSONSummaryEvent struct {
+	Type        string  `json:"type"`
+	Hosts       int     `json:"hosts"`
+	Successes   uint32  `json:"successes"`
+	Failures    uint32  `json:"failures"`
+	TimedOut    uint32  `json:"timed_out"`
+	Interrupted uint32  `json:"interrupted"`
+	Skipped     uint32  `json:"skipped"`
+	ElapsedSecs float64 `json:"elapsed_secs"`
+}
+
+// JSONPlanEvent is emitted on a dry run for every host, with exactly how it would be run.
+type JSONPlanEvent struct {
+	Type       string `json:"type"`
+	Batch      int    `json:"batch"`
+	Canary     bool   `json:"canary,omitempty"`
+	Idx        int    `json:"idx"`
+	Host       string `json:"host"`
+	Alias      string `json:"alias,omitempty"`
+	Invocation string `json:"invocation,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// JSONDryRunEvent is the last event of a dry run, describing the run as a whole.
+type JSONDryRunEvent struct {
+	Type           string  `json:"type"`
+	Desc           string  `json:"desc"`
+	Hosts          int     `json:"hosts"`
+	Batches        int     `json:"batches"`
+	Concurrency    int     `json:"concurrency"`
+	CmdTimeoutSecs float64 `json:"cmd_timeout_secs"`
+	DeadlineSecs   float64 `json:"deadline_secs"`
+	Rollout        string  `json:"rollout"`
+}
+
+// jsonOutput emits the run as NDJSON, one event per line, so that it can be piped into jq or a log shipper. Every
+// line of output is an event of type "line", every host gets an event of type "host" once it completes (skipped
+// hosts once the run is over) and a final event of type "summary" closes the run. Unlike the terminal rendering,
+// stderr is always included as every line carries its stream.
+type jsonOutput struct {
+	enc   *jsoniter.Encoder
+	start time.Time
+	// done tracks the hosts whose completion event was emitted.
+	done map[int]bool
+}
+
+func newJSONOutput(w io.Writer) *jsonOutput {
+	return &jsonOutput{
+		enc:   jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w),
+		start: time.Now(),
+		done:  make(map[int]bool),
+	}
+}
+
+func (j *jsonOutput) hostStarted(ctx context.Context, idx int) {}
+
+func (j *jsonOutput) line(ctx context.Context, hl hostLine) {
+	stream := "stdout"
+	if hl.stderr {
+		stream = "stderr"
+	}
+
+	j.write(&JSONLineEvent{
+		Type:   "line",
+		Idx:    hl.idx,
+		Host:   hl.hostname,
+		Alias:  hl.alias,
+		Stream: stream,
+		Line:   hl.line,
+		Time:   hl.ts,
+	})
+}
+
+func (j *jsonOutput) hostDone(ctx context.Context, res *RemoteCmdResult) {
+	j.done[res.Idx] = true
+	j.write(newJSONHostEvent(res))
+}
+
+func (j *jsonOutput) finish(ctx context.Context, results RemoteCmdResults) {
+	// Hosts which never started only show up now.
+	for _, res := range results {
+		if res != nil && !j.done[res.Idx] {
+			j.hostDone(ctx, res)
+		}
+	}
+
+	sum := results.Summary(time.Since(j.start))
+	j.write(&JSONSummaryEvent{
+		Type:        "summary",
+		Hosts:       len(results),
+		Successes:   sum.Successes,
+		Failures:    sum.Failures,
+		TimedOut:    sum.TimedOut,
+		Interrupted: sum.Interrupted,
+		Skipped:     sum.Skipped,
+		ElapsedSecs: sum.Elapsed.Seconds(),
+	})
+}
+
+func (j *jsonOutput) write(event any) {
+	if err := j.enc.Encode(event); err != nil {
+		log.Error("error writing json event", "error", err)
+	}
+}
+
+// renderDryRunJSON is the json counterpart of renderDryRun: a "plan" event for every host followed by a final "dry_run"
+// event, so a dry run can be piped into the very same tooling as the real run.
+func renderDryRunJSON(ctx context.Context, w io.Writer, hosts []RemoteCmdHost, desc string, plan hostPlan) {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	j := newJSONOutput(w)
+
+	batches := cfg.Rollout.Batches(len(hosts))
+	for batchIdx, batch := range batches {
+		for _, idx := range batch {
+			host := hosts[idx]
+			event := &JSONPlanEvent{
+				Type:   "plan",
+				Batch:  batchIdx + 1,
+				Canary: cfg.Rollout.Canary > 0 && batchIdx == 0,
+				Idx:    idx,
+				Host:   host.Original,
+				Alias:  host.Alias,
+			}
+			if invocation, err := plan(ctx, idx, host); err != nil {
+				event.Error = err.Error()
+			} else {
+				event.Invocation = invocation
+			}
+			j.write(event)
+		}
+	}
+
+	j.write(&JSONDryRunEvent{
+		Type:           "dry_run",
+		Desc:           desc,
+		Hosts:          len(hosts),
+		Batches:        len(batches),
+		Concurrency:    cfg.Concurrency,
+		CmdTimeoutSecs: cfg.CmdTimeout.Seconds(),
+		DeadlineSecs:   cfg.Deadline.Seconds(),
+		Rollout:        cfg.Rollout.String(),
+	})
+}
+
+// newJSONHostEvent describes how a host fared, it has the same shape as the status record of a transcript.
+func newJSONHostEvent(res *RemoteCmdResult) *TranscriptStatus {
+	event := newTranscriptStatus(res)
+	event.Type = "host"
+	return event
+}
@@ -0,0 +1,114 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteClusterRemoteCmdJSON(t *testing.T) {
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		_, _ = io.WriteString(req.Stdout, host+" up\n")
+		_, _ = io.WriteString(req.Stderr, host+" oops\n")
+		if host == "bar" {
+			return 2, errors.New("exit status 2")
+		}
+		return 0, nil
+	}}
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 1
+	cfgCtx.JsonOutput = true
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{{Original: "foo"}, {Original: "bar", Alias: "baz"}}
+
+	var b bytes.Buffer
+	ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "uptime")
+
+	var events []map[string]any
+	scanner := bufio.NewScanner(&b)
+	for scanner.Scan() {
+		var event map[string]any
+		assert.NoError(t, jsoniter.Unmarshal(scanner.Bytes(), &event), "every line is a json object")
+		events = append(events, event)
+	}
+
+	// Two lines and a completion per host followed by the summary, with nothing else mixed in.
+	var types []string
+	for _, event := range events {
+		types = append(types, event["type"].(string))
+	}
+	assert.ElementsMatch(t, []string{"line", "line", "host", "line", "line", "host", "summary"}, types)
+	assert.Equal(t, "summary", types[len(types)-1])
+
+	for _, event := range events {
+		switch {
+		case event["type"] == "line" && event["host"] == "bar":
+			assert.Equal(t, "baz", event["alias"])
+			assert.Contains(t, []any{"bar up", "bar oops"}, event["line"])
+			if event["line"] == "bar oops" {
+				assert.Equal(t, "stderr", event["stream"], "stderr is always included")
+			}
+			assert.NotEmpty(t, event["ts"])
+		case event["type"] == "host" && event["host"] == "bar":
+			assert.Equal(t, "failed", event["status"])
+			assert.EqualValues(t, 2, event["exit_code"])
+		case event["type"] == "summary":
+			assert.EqualValues(t, 2, event["hosts"])
+			assert.EqualValues(t, 1, event["successes"])
+			assert.EqualValues(t, 1, event["failures"])
+		}
+	}
+}
+
+func TestJSONOutputSkippedHosts(t *testing.T) {
+	ctx := context.WithValue(context.Background(), CtxKeyConfig, NewConfigCtx())
+
+	var b bytes.Buffer
+	out := newJSONOutput(&b)
+
+	hosts := []RemoteCmdHost{{Original: "a"}, {Original: "b"}}
+	out.hostDone(ctx, &RemoteCmdResult{Host: hosts[0], Idx: 0, Status: StatusSucceeded})
+	out.finish(ctx, RemoteCmdResults{
+		{Host: hosts[0], Idx: 0, Status: StatusSucceeded},
+		skippedResult(1, hosts[1], nil),
+	})
+
+	lines := bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 3, "a host event each, without repeating the completed host, and the summary")
+	assert.Contains(t, string(lines[1]), `"status":"skipped"`)
+	assert.Contains(t, string(lines[2]), `"skipped":1`)
+}
@@ -0,0 +1,290 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/charmbracelet/log"
+	"golang.org/x/term"
+)
+
+const (
+	// GroupOrderCompletion prints each host's block as soon as that host completes.
+	GroupOrderCompletion = "completion"
+	// GroupOrderIndex prints the blocks by host index, holding back any host that finishes ahead of its turn.
+	GroupOrderIndex = "index"
+)
+
+// remoteOutput receives everything produced during a cluster run and decides how it gets rendered. All of its
+// methods are only ever invoked from the single polling goroutine so implementations need no locking.
+type remoteOutput interface {
+	// hostStarted is invoked once a host has started, hosts which are skipped never start.
+	hostStarted(ctx context.Context, idx int)
+	// line is invoked for every line of output as it arrives.
+	line(ctx context.Context, hl hostLine)
+	// hostDone is invoked once a host has completed, after its last line.
+	hostDone(ctx context.Context, res *RemoteCmdResult)
+	// finish is invoked once the whole run is over, just before the summary is rendered. Hosts which never started
+	// are only present within these results.
+	finish(ctx context.Context, results RemoteCmdResults)
+}
+
+// newRemoteOutput picks the output mode dictated by the config, additionally recording a transcript when an output
+// directory is configured and the job when running detached.
+func newRemoteOutput(ctx context.Context, w io.Writer, hosts []RemoteCmdHost) remoteOutput {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	outputs := teeOutput{newTerminalOutput(ctx, w, hosts)}
+
+	if len(cfg.OutputDir) > 0 {
+		transcript, err := newTranscriptOutput(cfg.OutputDir)
+		if err != nil {
+			log.Error("error creating transcript, continuing without one", "outputDir", cfg.OutputDir, "error", err)
+		} else {
+			outputs = append(outputs, transcript)
+		}
+	}
+
+	// A detached runner records everything into its job.
+	if len(cfg.JobID) > 0 {
+		job, err := newJobOutput(ctx, cfg.JobID, hosts)
+		if err != nil {
+			log.Error("error picking up the job, continuing without it", "job", cfg.JobID, "error", err)
+		} else {
+			outputs = append(outputs, job)
+		}
+	}
+
+	if len(outputs) == 1 {
+		return outputs[0]
+	}
+	return outputs
+}
+
+// newTerminalOutput picks how the output is rendered to w.
+func newTerminalOutput(ctx context.Context, w io.Writer, hosts []RemoteCmdHost) remoteOutput {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+
+	if cfg.JsonOutput {
+		return newJSONOutput(w)
+	}
+
+	if cfg.Dashboard {
+		if f, ok := w.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			return newDashboardOutput(ctx, w, hosts)
+		}
+		log.Warn("the dashboard requires a terminal, streaming the output instead")
+	}
+
+	if cfg.Collapse {
+		return &collapsedOutput{w: w, withExitCode: cfg.CollapseExitCode}
+	}
+
+	if cfg.Grouped {
+		return &groupedOutput{
+			w:       w,
+			byIndex: cfg.GroupOrder == GroupOrderIndex,
+			pending: make(map[int]*hostBlock),
+		}
+	}
+
+	return &streamOutput{w: w}
+}
+
+// ValidateGroupOrder returns an error when order is not one of the supported group orders.
+func ValidateGroupOrder(order string) error {
+	switch order {
+	case GroupOrderCompletion, GroupOrderIndex:
+		return nil
+	}
+	return fmt.Errorf("unknown group order: %q, expected one of: %s or %s",
+		order, GroupOrderCompletion, GroupOrderIndex)
+}
+
+// streamOutput is the default mode, every line is rendered the moment it arrives prefixed by its host.
+type streamOutput struct {
+	w io.Writer
+}
+
+func (s *streamOutput) hostStarted(ctx context.Context, idx int) {}
+
+func (s *streamOutput) line(ctx context.Context, hl hostLine) {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+
+	// Stdout is always rendered, stderr only when requested.
+	if hl.stderr && !cfg.Stderr {
+		return
+	}
+	RenderLogLine(ctx, s.w, hl.idx, hl.stderr, hl.hostname, hl.alias, hl.line)
+}
+
+func (s *streamOutput) hostDone(ctx context.Context, res *RemoteCmdResult) {}
+
+func (s *streamOutput) finish(ctx context.Context, results RemoteCmdResults) {}
+
+// hostBlock is the buffered output of a single host.
+type hostBlock struct {
+	res   *RemoteCmdResult
+	lines []hostLine
+}
+
+// groupedOutput buffers the full output of each host and renders it as one contiguous block with a header once the
+// host completes. This keeps the output of a host together which is much easier to review across many hosts.
+type groupedOutput struct {
+	w       io.Writer
+	byIndex bool
+	// pending holds the blocks that have not been rendered yet, keyed by host index.
+	pending map[int]*hostBlock
+	// nextIdx is the next host index to render when ordering by index.
+	nextIdx int
+}
+
+func (g *groupedOutput) block(idx int) *hostBlock {
+	b, ok := g.pending[idx]
+	if !ok {
+		b = &hostBlock{}
+		g.pending[idx] = b
+	}
+	return b
+}
+
+func (g *groupedOutput) hostStarted(ctx context.Context, idx int) {}
+
+func (g *groupedOutput) line(ctx context.Context, hl hostLine) {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+
+	if hl.stderr && !cfg.Stderr {
+		return
+	}
+	b := g.block(hl.idx)
+	b.lines = append(b.lines, hl)
+}
+
+func (g *groupedOutput) hostDone(ctx context.Context, res *RemoteCmdResult) {
+	g.block(res.Idx).res = res
+
+	if !g.byIndex {
+		g.render(ctx, res.Idx)
+		return
+	}
+
+	// Render every completed block in index order up until the first host still running.
+	for {
+		b, ok := g.pending[g.nextIdx]
+		if !ok || b.res == nil {
+			return
+		}
+		g.render(ctx, g.nextIdx)
+		g.nextIdx++
+	}
+}
+
+func (g *groupedOutput) finish(ctx context.Context, results RemoteCmdResults) {
+	if !g.byIndex {
+		return
+	}
+
+	// Any host that never started holds up everything after it, so render whatever remains in index order now.
+	for ; g.nextIdx < len(results); g.nextIdx++ {
+		b, ok := g.pending[g.nextIdx]
+		if !ok || b.res == nil {
+			continue
+		}
+		g.render(ctx, g.nextIdx)
+	}
+}
+
+func (g *groupedOutput) render(ctx context.Context, idx int) {
+	b := g.pending[idx]
+	delete(g.pending, idx)
+
+	// Skipped hosts never produced any output, the summary already accounts for them.
+	if b.res.Status == StatusSkipped {
+		return
+	}
+	renderHostBlock(ctx, g.w, b.res, b.lines)
+}
+
+// collapsedOutput waits for the whole run to finish and then prints each distinct stdout only once, beneath the
+// compacted list of hosts which produced it, similar to dshbak -c. This makes the odd hosts out easy to spot.
+type collapsedOutput struct {
+	w io.Writer
+	// withExitCode additionally requires the exit codes to match for hosts to be collapsed together.
+	withExitCode bool
+}
+
+func (c *collapsedOutput) hostStarted(ctx context.Context, idx int) {}
+
+func (c *collapsedOutput) line(ctx context.Context, hl hostLine) {}
+
+func (c *collapsedOutput) hostDone(ctx context.Context, res *RemoteCmdResult) {}
+
+func (c *collapsedOutput) finish(ctx context.Context, results RemoteCmdResults) {
+	type collapsedGroup struct {
+		res   *RemoteCmdResult
+		names []string
+	}
+
+	var (
+		groups []*collapsedGroup
+		byKey  = make(map[string]*collapsedGroup)
+	)
+
+	// Groups are kept in the order of the first host having that output.
+	for _, res := range results {
+		if res == nil || res.Status == StatusSkipped {
+			continue
+		}
+
+		key := string(res.Stdout)
+		if c.withExitCode {
+			key = fmt.Sprintf("%d\x00%s", res.ExitCode, key)
+		}
+
+		g, ok := byKey[key]
+		if !ok {
+			g = &collapsedGroup{res: res}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.names = append(g.names, hostDisplayName(res.Host))
+	}
+
+	for _, g := range groups {
+		renderCollapsedBlock(ctx, c.w, g.names, g.res, c.withExitCode)
+	}
+}
+
+// hostDisplayName returns the name a host is shown as, its alias when it has one.
+func hostDisplayName(host RemoteCmdHost) string {
+	if len(host.Alias) > 0 {
+		return host.Alias
+	}
+	return host.Original
+}
@@ -0,0 +1,174 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateGroupOrder(t *testing.T) {
+	assert.NoError(t, ValidateGroupOrder(GroupOrderCompletion))
+	assert.NoError(t, ValidateGroupOrder(GroupOrderIndex))
+	assert.Error(t, ValidateGroupOrder("random"))
+}
+
+func TestGroupedOutputIndexOrder(t *testing.T) {
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.NoColor = true
+	cfgCtx.Grouped = true
+	cfgCtx.GroupOrder = GroupOrderIndex
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	var b bytes.Buffer
+	out := newRemoteOutput(ctx, &b, nil)
+
+	hosts := []RemoteCmdHost{{Original: "a"}, {Original: "b"}, {Original: "c"}, {Original: "d"}}
+	done := func(idx int, status RemoteCmdStatus) {
+		out.hostDone(ctx, &RemoteCmdResult{Host: hosts[idx], Idx: idx, Status: status})
+	}
+
+	// Lines of different hosts arrive interleaved.
+	out.line(ctx, hostLine{idx: 1, hostname: "b", line: "b1"})
+	out.line(ctx, hostLine{idx: 0, hostname: "a", line: "a1"})
+	out.line(ctx, hostLine{idx: 1, hostname: "b", line: "b2"})
+	out.line(ctx, hostLine{idx: 0, hostname: "a", line: "a2", stderr: true})
+
+	// Host b finishes first but must wait on host a.
+	done(1, StatusSucceeded)
+	assert.Empty(t, b.String(), "nothing renders until host 0 completes")
+
+	done(0, StatusSucceeded)
+	assert.Equal(t, "=== a (0): succeeded, exit code: 0, elapsed (secs): 0.00\na1\n"+
+		"=== b (1): succeeded, exit code: 0, elapsed (secs): 0.00\nb1\nb2\n", b.String(),
+		"stderr is left out unless requested")
+
+	// Host c never started, so host d is only rendered once the run is finished.
+	b.Reset()
+	out.line(ctx, hostLine{idx: 3, hostname: "d", line: "d1"})
+	done(3, StatusFailed)
+	assert.Empty(t, b.String())
+
+	out.finish(ctx, RemoteCmdResults{nil, nil, skippedResult(2, hosts[2], nil), nil})
+	assert.Equal(t, "=== d (3): failed, exit code: 0, elapsed (secs): 0.00\nd1\n", b.String())
+}
+
+func TestExecuteClusterRemoteCmdGrouped(t *testing.T) {
+	// Each host writes its lines one at a time so streamed output would interleave.
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		for i := 0; i < 3; i++ {
+			_, _ = io.WriteString(req.Stdout, host+"\n")
+		}
+		_, _ = io.WriteString(req.Stderr, host+" oops\n")
+		return 0, nil
+	}}
+
+	for _, order := range []string{GroupOrderCompletion, GroupOrderIndex} {
+		ctx := context.Background()
+		cfgCtx := NewConfigCtx()
+		cfgCtx.Concurrency = 5
+		cfgCtx.NoColor = true
+		cfgCtx.Stderr = true
+		cfgCtx.Grouped = true
+		cfgCtx.GroupOrder = order
+		ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+		hosts := []RemoteCmdHost{{Original: "foo"}, {Original: "bar"}, {Original: "baz", Alias: "qux"}}
+
+		var b bytes.Buffer
+		results := ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "whatever")
+		assert.Equal(t, 3, results.Successes())
+
+		out := b.String()
+		for idx, h := range hosts {
+			name := h.Original
+			if h.Alias != "" {
+				name = h.Alias
+			}
+			assert.Contains(t, out, name+" ("+string(rune('0'+idx))+"): succeeded", "each host gets a header")
+			assert.Contains(t, out, strings.Repeat(h.Original+"\n", 3)+">2 "+h.Original+" oops\n",
+				"the output of a host is contiguous")
+		}
+
+		if order == GroupOrderIndex {
+			assert.Less(t, strings.Index(out, "foo (0)"), strings.Index(out, "bar (1)"))
+			assert.Less(t, strings.Index(out, "bar (1)"), strings.Index(out, "qux (2)"))
+		}
+	}
+}
+
+func TestExecuteClusterRemoteCmdCollapse(t *testing.T) {
+	// Every host agrees, except for a couple of misconfigured ones.
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		switch host {
+		case "blade-0003":
+			_, _ = io.WriteString(req.Stdout, "nginx: inactive\n")
+			return 3, errors.New("exit status 3")
+		case "peanut-0003":
+			_, _ = io.WriteString(req.Stdout, "nginx: active\n")
+			return 1, errors.New("exit status 1")
+		}
+		_, _ = io.WriteString(req.Stdout, "nginx: active\n")
+		return 0, nil
+	}}
+
+	var hosts []RemoteCmdHost
+	for i := 1; i <= 5; i++ {
+		hosts = append(hosts, RemoteCmdHost{Original: fmt.Sprintf("blade-%04d", i)})
+	}
+	hosts = append(hosts, RemoteCmdHost{Original: "peanut-0003"})
+
+	newCtx := func(withExitCode bool) context.Context {
+		cfgCtx := NewConfigCtx()
+		cfgCtx.Concurrency = 5
+		cfgCtx.NoColor = true
+		cfgCtx.Collapse = true
+		cfgCtx.CollapseExitCode = withExitCode
+		return context.WithValue(context.Background(), CtxKeyConfig, cfgCtx)
+	}
+
+	var b bytes.Buffer
+	results := ExecuteClusterRemoteCmd(newCtx(false), &b, executor, hosts, "whatever")
+	assert.Equal(t, 4, results.Successes())
+	assert.True(t, strings.HasPrefix(b.String(),
+		"=== blade-[0001-0002,0004-0005],peanut-0003 (5 hosts)\nnginx: active\n"+
+			"=== blade-0003 (1 host)\nnginx: inactive\n"), "unexpected output: %s", b.String())
+
+	b.Reset()
+	ExecuteClusterRemoteCmd(newCtx(true), &b, executor, hosts, "whatever")
+	assert.True(t, strings.HasPrefix(b.String(),
+		"=== blade-[0001-0002,0004-0005] (4 hosts), exit code: 0\nnginx: active\n"+
+			"=== blade-0003 (1 host), exit code: 3\nnginx: inactive\n"+
+			"=== peanut-0003 (1 host), exit code: 1\nnginx: active\n"), "unexpected output: %s", b.String())
+}
@@ -0,0 +1,94 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/deckarep/tips/pkg/utils"
+)
+
+// ExecuteClusterScript runs a local script on every host with the given arguments. The script is streamed to each
+// host over stdin, staged in a remote temp file, run and then removed again whether it succeeded or not. The script is
+// run by the interpreter of its shebang, so it needn't be a shell script. It shares the concurrency, rollout, output
+// rendering and summary of remote commands.
+func ExecuteClusterScript(ctx context.Context, w io.Writer, executor RemoteExecutor, hosts []RemoteCmdHost,
+	scriptPath string, script []byte, args []string) RemoteCmdResults {
+	remoteCmd := scriptRemoteCmd(script, args)
+
+	return executeCluster(ctx, w, hosts, "script: "+filepath.Base(scriptPath),
+		func(ctx context.Context, idx int, host RemoteCmdHost, outputChan chan<- hostLine) *RemoteCmdResult {
+			// Stdin carries the script, so no tty may be requested.
+			req := ExecRequest{Cmd: remoteCmd, Stdin: bytes.NewReader(script)}
+			return runExec(ctx, executor, idx, host, req, outputChan)
+		},
+		func(ctx context.Context, idx int, host RemoteCmdHost) (string, error) {
+			return executor.Describe(host.Original, &ExecRequest{Cmd: remoteCmd, Tags: host.Tags()}) + " < " + scriptPath, nil
+		})
+}
+
+// scriptRemoteCmd returns the remote command which stages the script arriving on stdin, runs it with args and cleans
+// up after itself. It's wrapped in sh -c so that it doesn't depend on the login shell of the remote user.
+//
+// The staged script is handed to its interpreter rather than executed, as the temp dir is often mounted noexec on
+// hardened hosts.
+func scriptRemoteCmd(script []byte, args []string) string {
+	quotedArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		quotedArgs = append(quotedArgs, utils.ShellQuote(arg))
+	}
+
+	// The exit trap preserves the exit code of the script.
+	staged := fmt.Sprintf(`f=$(mktemp "${TMPDIR:-/tmp}/tips-script.XXXXXX") || exit 1; trap 'rm -f "$f"' EXIT; `+
+		`cat > "$f" && %s "$f" %s`, scriptInterpreter(script), strings.Join(quotedArgs, " "))
+
+	return "sh -c " + utils.ShellQuote(strings.TrimSpace(staged))
+}
+
+// scriptInterpreter returns the interpreter named by the shebang of the script, quoted for a posix shell. Just like
+// the kernel does, everything following the interpreter is passed along as a single argument. Scripts without a
+// shebang are run by sh.
+func scriptInterpreter(script []byte) string {
+	firstLine, _, _ := bytes.Cut(script, []byte("\n"))
+	shebang, ok := bytes.CutPrefix(bytes.TrimRight(firstLine, "\r"), []byte("#!"))
+	if !ok {
+		return "sh"
+	}
+
+	interpreter, arg, _ := strings.Cut(strings.TrimSpace(string(shebang)), " ")
+	if len(interpreter) == 0 {
+		return "sh"
+	}
+	if arg = strings.TrimSpace(arg); len(arg) > 0 {
+		return utils.ShellQuoteIfNeeded(interpreter) + " " + utils.ShellQuoteIfNeeded(arg)
+	}
+	return utils.ShellQuoteIfNeeded(interpreter)
+}
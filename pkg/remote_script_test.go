@@ -0,0 +1,111 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteClusterScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh binary is a shell script")
+	}
+
+	// Multi-line logic and awkward arguments are exactly what's fragile to quote into a remote command.
+	script := `#!/bin/sh
+echo "args: $#"
+for a in "$@"; do
+  echo "arg: $a"
+done
+echo "path: $0"
+test -x "$0" || echo "not executable"
+exit 4
+`
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 2
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{{Original: "foo"}, {Original: "bar"}}
+
+	var b bytes.Buffer
+	results := ExecuteClusterScript(ctx, &b, newFakeSSH(t), hosts, "./fix.sh", []byte(script),
+		[]string{"one two", "it's", "$HOME"})
+
+	assert.Len(t, results.Failed(), 2)
+	for _, res := range results {
+		assert.Equal(t, 4, res.ExitCode, "the exit code of the script comes back")
+
+		out := string(res.Stdout)
+		assert.True(t, strings.HasPrefix(out, "args: 3\narg: one two\narg: it's\narg: $HOME\npath: "), out)
+
+		// The staged script is gone once it has run.
+		stagedPath := strings.TrimSpace(out[strings.Index(out, "path: ")+len("path: "):])
+		assert.Contains(t, stagedPath, "tips-script.")
+		_, err := os.Stat(stagedPath)
+		assert.True(t, os.IsNotExist(err), "the staged script should have been removed: %s", stagedPath)
+		assert.Contains(t, out, "not executable", "the script runs without exec permission, as on a noexec temp dir")
+	}
+
+	assert.Contains(t, b.String(), "foo >1 (0): arg: it's")
+}
+
+func TestScriptRemoteCmd(t *testing.T) {
+	cmd := scriptRemoteCmd([]byte("echo hi\n"), nil)
+	assert.True(t, strings.HasPrefix(cmd, "sh -c 'f=$(mktemp"))
+	assert.True(t, strings.HasSuffix(cmd, `&& sh "$f"'`), "no trailing arguments")
+
+	// The staged script is never executed itself, so a noexec temp dir doesn't matter.
+	assert.NotContains(t, cmd, "chmod")
+	assert.NotContains(t, cmd, `&& "$f"`)
+}
+
+func TestScriptInterpreter(t *testing.T) {
+	tests := []struct {
+		script   string
+		expected string
+	}{
+		{"echo hi\n", "sh"},
+		{"", "sh"},
+		{"#!/bin/sh\necho hi\n", "/bin/sh"},
+		{"#!/bin/bash -eu\r\necho hi\n", "/bin/bash -eu"},
+		{"#! /usr/bin/env python3\nprint('hi')\n", "/usr/bin/env python3"},
+		{"#!/usr/bin/env -S awk -f\n", "/usr/bin/env '-S awk -f'"},
+		{"#!\n", "sh"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, scriptInterpreter([]byte(tt.script)), tt.script)
+	}
+}
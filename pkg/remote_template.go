@@ -0,0 +1,130 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"strings"
+	"text/template"
+
+	"github.com/deckarep/tips/pkg/utils"
+)
+
+// HostTemplateData is what a templated remote command is evaluated against for each host, such as:
+// 'curl -s http://{{.IPv4}}:9100/metrics' or 'echo {{.Machine}} {{.Tags}}'. The fields are rendered just as their
+// columns are in the table, with the raw device available for anything else. A remote command is only ever a template
+// when asked for with --template.
+type HostTemplateData struct {
+	// Idx is the index of the host within the run.
+	Idx           int
+	No            string
+	Machine       string
+	Hostname      string
+	Fullname      string
+	Alias         string
+	Address       string
+	IPv4          string
+	IPv6          string
+	OS            string
+	User          string
+	Tags          string
+	TagList       []string
+	ClientVersion string
+	Version       string
+	Device        *WrappedDevice
+}
+
+// templateFuncs are the extra functions available to remote command templates.
+var templateFuncs = template.FuncMap{
+	// quote makes a value safe to use as a single shell argument: {{quote .Tags}}
+	"quote": utils.ShellQuote,
+}
+
+// IsRemoteCmdTemplate reports whether the remote command has any template actions to be evaluated per host.
+func IsRemoteCmdTemplate(remoteCmd string) bool {
+	return strings.Contains(remoteCmd, "{{")
+}
+
+// ValidateRemoteCmdTemplate checks a templated remote command up front, so mistakes such as an unknown field are
+// caught once rather than failing on every single host.
+func ValidateRemoteCmdTemplate(remoteCmd string) error {
+	tmpl, err := parseRemoteCmdTemplate(remoteCmd)
+	if err != nil || tmpl == nil {
+		return err
+	}
+	return tmpl.Execute(&strings.Builder{}, &HostTemplateData{Device: &WrappedDevice{}})
+}
+
+// parseRemoteCmdTemplate parses the remote command as a template, it returns nil when it isn't one.
+func parseRemoteCmdTemplate(remoteCmd string) (*template.Template, error) {
+	if !IsRemoteCmdTemplate(remoteCmd) {
+		return nil, nil
+	}
+	return template.New("remote command").Funcs(templateFuncs).Option("missingkey=error").Parse(remoteCmd)
+}
+
+// renderRemoteCmd evaluates the template against the host.
+func renderRemoteCmd(ctx context.Context, tmpl *template.Template, idx int, host RemoteCmdHost) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, newHostTemplateData(ctx, idx, host)); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func newHostTemplateData(ctx context.Context, idx int, host RemoteCmdHost) *HostTemplateData {
+	data := &HostTemplateData{
+		Idx:     idx,
+		Machine: host.Original,
+		Alias:   host.Alias,
+		Device:  host.Device,
+	}
+
+	dev := host.Device
+	if dev == nil {
+		// Without a device only the name is known.
+		return data
+	}
+
+	data.No = dev.EvalColumnField(ctx, idx, MatchNameNo)
+	data.Machine = dev.EvalColumnField(ctx, idx, MatchNameMachine)
+	data.Hostname = dev.EvalColumnField(ctx, idx, MatchNameHostname)
+	data.Fullname = dev.EvalColumnField(ctx, idx, MatchNameFullname)
+	data.Address = dev.EvalColumnField(ctx, idx, MatchNameAddress)
+	data.IPv4 = dev.EvalColumnField(ctx, idx, MatchNameIpv4)
+	data.IPv6 = dev.EvalColumnField(ctx, idx, MatchNameIpv6)
+	data.OS = dev.EvalColumnField(ctx, idx, MatchNameOS)
+	data.User = dev.EvalColumnField(ctx, idx, MatchNameUser)
+	data.Tags = dev.EvalColumnField(ctx, idx, MatchNameTags)
+	data.ClientVersion = dev.EvalColumnField(ctx, idx, MatchNameClientVersion)
+	data.Version = dev.EvalColumnField(ctx, idx, MatchNameVersion)
+
+	for _, tag := range dev.Tags {
+		data.TagList = append(data.TagList, strings.TrimPrefix(tag, "tag:"))
+	}
+
+	return data
+}
@@ -0,0 +1,106 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tailscale/tailscale-client-go/tailscale"
+)
+
+func TestValidateRemoteCmdTemplate(t *testing.T) {
+	assert.NoError(t, ValidateRemoteCmdTemplate("uptime"), "a plain remote command is fine")
+	assert.NoError(t, ValidateRemoteCmdTemplate("curl -s http://{{.IPv4}}:9100/metrics | head -1"))
+	assert.NoError(t, ValidateRemoteCmdTemplate("echo {{quote .Tags}} {{.Device.Name}}"))
+
+	assert.Error(t, ValidateRemoteCmdTemplate("echo {{.Machine"), "unterminated action")
+	assert.Error(t, ValidateRemoteCmdTemplate("echo {{.Bogus}}"), "unknown field")
+	assert.Error(t, ValidateRemoteCmdTemplate("echo {{bogus .Machine}}"), "unknown func")
+}
+
+func TestExecuteClusterRemoteCmdTemplate(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		cmds = make(map[string]string)
+	)
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		cmds[host] = req.Cmd
+		return 0, nil
+	}}
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 5
+	cfgCtx.Template = true
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{
+		{Original: "blade-01", Device: &WrappedDevice{Device: tailscale.Device{
+			Name:      "blade-01.tail372c.ts.net",
+			Addresses: []string{"100.64.0.1", "fd7a:115c:a1e0::1"},
+			Tags:      []string{"tag:web", "tag:prod"},
+			OS:        "linux",
+		}}},
+		{Original: "blade-02", Device: &WrappedDevice{Device: tailscale.Device{
+			Name:      "blade-02.tail372c.ts.net",
+			Addresses: []string{"100.64.0.2"},
+		}}},
+		// Without a device only the name is known.
+		{Original: "mystery"},
+	}
+
+	var b bytes.Buffer
+	results := ExecuteClusterRemoteCmd(ctx, &b, executor, hosts,
+		"echo {{.Idx}} {{.Machine}} {{.IPv4}} {{quote .Tags}} {{range .TagList}}[{{.}}]{{end}} {{.OS}}")
+	assert.Equal(t, 3, results.Successes())
+
+	assert.Equal(t, "echo 0 blade-01 100.64.0.1 'web, prod' [web][prod] linux", cmds["blade-01"])
+	assert.Equal(t, "echo 1 blade-02 100.64.0.2 ''  ", cmds["blade-02"])
+	assert.Equal(t, "echo 2 mystery  ''  ", cmds["mystery"])
+
+	// Evaluation errors fail the host rather than running a half rendered command.
+	clear(cmds)
+	results = ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "echo {{.Device.Name}}")
+	assert.Equal(t, 2, results.Successes())
+	assert.Len(t, results.Failed(), 1)
+	assert.Equal(t, "mystery", results.Failed()[0].Host.Original)
+	assert.NotContains(t, cmds, "mystery")
+	assert.Equal(t, "echo blade-01.tail372c.ts.net", cmds["blade-01"])
+
+	// Without --template the remote command is sent as is, like any command carrying braces of its own.
+	cfgCtx.Template = false
+	clear(cmds)
+	results = ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "docker ps --format '{{.Names}}'")
+	assert.Equal(t, 3, results.Successes())
+	assert.Equal(t, "docker ps --format '{{.Names}}'", cmds["mystery"])
+	assert.Equal(t, "docker ps --format '{{.Names}}'", cmds["blade-01"])
+}
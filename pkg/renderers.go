@@ -42,24 +42,53 @@ import (
 	jsoniter "github.com/json-iterator/go"
 )
 
-func RenderRemoteSummary(ctx context.Context, w io.Writer, success, errors uint32, elapsed time.Duration) error {
-	succStr := ui.Styles.Green.Render(fmt.Sprintf("%d", success))
-	errStr := ui.Styles.Faint.Render(fmt.Sprintf("%d", errors))
+func RenderRemoteSummary(ctx context.Context, w io.Writer, summary RemoteCmdSummary) error {
+	succStr := ui.Styles.Green.Render(fmt.Sprintf("%d", summary.Successes))
+	errStr := ui.Styles.Faint.Render(fmt.Sprintf("%d", summary.Failures))
 
 	// Upon any errors lets highlight this fact.
-	if errors > 0 {
-		succStr = ui.Styles.Faint.Render(fmt.Sprintf("%d", success))
-		errStr = ui.Styles.Red.Render(fmt.Sprintf("%d", errors))
+	if summary.Failures > 0 {
+		succStr = ui.Styles.Faint.Render(fmt.Sprintf("%d", summary.Successes))
+		errStr = ui.Styles.Red.Render(fmt.Sprintf("%d", summary.Failures))
 	}
 
-	summary := fmt.Sprintf("Finished: successes: %s, failures: %s, elapsed (secs): %.2f",
+	// Skipped hosts only show up when a rollout was halted early.
+	var skippedStr string
+	if summary.Skipped > 0 {
+		skippedStr = fmt.Sprintf(", skipped: %s", ui.Styles.Yellow.Render(fmt.Sprintf("%d", summary.Skipped)))
+	}
+
+	// Timed out hosts are reported apart from ordinary failures.
+	var timedOutStr string
+	if summary.TimedOut > 0 {
+		timedOutStr = fmt.Sprintf(", timed out: %s", ui.Styles.Red.Render(fmt.Sprintf("%d", summary.TimedOut)))
+	}
+
+	// Interrupted hosts are reported apart from ordinary failures as well.
+	var interruptedStr string
+	if summary.Interrupted > 0 {
+		interruptedStr = fmt.Sprintf(", interrupted: %s", ui.Styles.Yellow.Render(fmt.Sprintf("%d", summary.Interrupted)))
+	}
+
+	summaryLine := fmt.Sprintf("Finished: successes: %s, failures: %s%s%s%s, elapsed (secs): %.2f",
 		succStr,
 		errStr,
-		elapsed.Seconds())
+		timedOutStr,
+		interruptedStr,
+		skippedStr,
+		summary.Elapsed.Seconds())
 
-	if _, err := fmt.Fprintln(w, summary); err != nil {
+	if _, err := fmt.Fprintln(w, summaryLine); err != nil {
 		log.Error("error on `Fprintln` when writing elapsed time", "error", err)
 	}
+
+	// Which hosts were interrupted matters, they may have been left half way through.
+	if len(summary.InterruptedHosts) > 0 {
+		if _, err := fmt.Fprintf(w, "Interrupted: %s\n",
+			ui.Styles.Yellow.Render(CompactHostnames(summary.InterruptedHosts))); err != nil {
+			log.Error("error on `Fprintf` when writing interrupted hosts", "error", err)
+		}
+	}
 	return nil
 }
 
@@ -89,6 +118,130 @@ func RenderLogLine(ctx context.Context, w io.Writer, idx int, isStdErr bool, hos
 	}
 }
 
+// renderHostBlock renders the buffered output of a single host as one contiguous block beneath a header describing
+// how the host fared.
+func renderHostBlock(ctx context.Context, w io.Writer, res *RemoteCmdResult, lines []hostLine) {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+
+	hostname := hostDisplayName(res.Host)
+
+	statusStr := ui.Styles.Green.Render(res.Status.String())
+	if !res.Success() {
+		statusStr = ui.Styles.Red.Render(res.Status.String())
+	}
+
+	header := fmt.Sprintf("%s %s %s, exit code: %d, elapsed (secs): %.2f",
+		ui.Styles.Faint.Render("==="),
+		ui.Styles.Cyan.Render(fmt.Sprintf("%s (%d):", hostname, res.Idx)),
+		statusStr,
+		res.ExitCode,
+		res.Elapsed().Seconds())
+
+	if _, err := fmt.Fprintln(w, header); err != nil {
+		log.Error("error occurred during `Fprintln` to the local io.Writer", "error", err)
+		return
+	}
+
+	for _, hl := range lines {
+		line := hl.line
+		if !cfg.NoColor {
+			line = applyColorRules(line)
+		}
+		if hl.stderr {
+			line = ui.Styles.Yellow.Render(">2 ") + line
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			log.Error("error occurred during `Fprintln` to the local io.Writer", "error", err)
+			return
+		}
+	}
+}
+
+// renderCollapsedBlock renders the stdout shared by all of the named hosts once, beneath a compact host-list header.
+// The exit code is only shown in the header when hosts were collapsed by it too.
+func renderCollapsedBlock(ctx context.Context, w io.Writer, names []string, res *RemoteCmdResult, withExitCode bool) {
+	hostsStr := "hosts"
+	if len(names) == 1 {
+		hostsStr = "host"
+	}
+
+	header := fmt.Sprintf("%s %s %s",
+		ui.Styles.Faint.Render("==="),
+		ui.Styles.Cyan.Render(CompactHostnames(names)),
+		ui.Styles.Faint.Render(fmt.Sprintf("(%d %s)", len(names), hostsStr)))
+
+	if withExitCode {
+		exitStr := ui.Styles.Green.Render(fmt.Sprintf("%d", res.ExitCode))
+		if res.ExitCode != 0 {
+			exitStr = ui.Styles.Red.Render(fmt.Sprintf("%d", res.ExitCode))
+		}
+		header += ", exit code: " + exitStr
+	}
+
+	output := string(res.Stdout)
+	if len(output) == 0 {
+		output = ui.Styles.Faint.Render("(no output)")
+	}
+
+	if _, err := fmt.Fprintln(w, header); err != nil {
+		log.Error("error occurred during `Fprintln` to the local io.Writer", "error", err)
+		return
+	}
+
+	// The output is printed verbatim, it only gains a newline when it lacks a trailing one.
+	if _, err := fmt.Fprint(w, output); err != nil {
+		log.Error("error occurred during `Fprint` to the local io.Writer", "error", err)
+		return
+	}
+	if !strings.HasSuffix(output, "\n") {
+		fmt.Fprintln(w)
+	}
+}
+
+// renderDryRun renders the plan of a cluster run without running anything: the exact invocation for every host grouped
+// by the batches they would run in, along with the concurrency and timeouts applied. With --json it's rendered as
+// NDJSON, see renderDryRunJSON.
+func renderDryRun(ctx context.Context, w io.Writer, hosts []RemoteCmdHost, desc string, plan hostPlan) {
+	cfg := CtxAsConfig(ctx, CtxKeyConfig)
+	if cfg.JsonOutput {
+		renderDryRunJSON(ctx, w, hosts, desc, plan)
+		return
+	}
+
+	var orNone = func(d time.Duration) string {
+		if d <= 0 {
+			return "none"
+		}
+		return d.String()
+	}
+
+	fmt.Fprintln(w, ui.Styles.Bold.Render("Dry run: ")+desc)
+	fmt.Fprintf(w, "Hosts: %d, concurrency: %d, cmd timeout: %s, deadline: %s\n",
+		len(hosts), cfg.Concurrency, orNone(cfg.CmdTimeout), orNone(cfg.Deadline))
+	fmt.Fprintf(w, "Rollout: %s\n", cfg.Rollout)
+
+	batches := cfg.Rollout.Batches(len(hosts))
+	for batchIdx, batch := range batches {
+		title := fmt.Sprintf("Batch %d of %d, %d host(s)", batchIdx+1, len(batches), len(batch))
+		if cfg.Rollout.Canary > 0 && batchIdx == 0 {
+			title += " (canary)"
+		}
+		fmt.Fprintln(w, ui.Styles.Cyan.Render(title))
+
+		for _, idx := range batch {
+			host := hosts[idx]
+			invocation, err := plan(ctx, idx, host)
+			if err != nil {
+				invocation = ui.Styles.Red.Render("error: " + err.Error())
+			}
+			fmt.Fprintf(w, "  %s: %s\n", ui.Styles.Cyan.Render(fmt.Sprintf("%s (%d)", hostDisplayName(host), idx)),
+				invocation)
+		}
+	}
+
+	fmt.Fprintln(w, ui.Styles.Faint.Render("Nothing was executed, this was a dry run."))
+}
+
 func RenderIPs(ctx context.Context, tableView *GeneralTableView, w io.Writer) error {
 	cfg := CtxAsConfig(ctx, CtxKeyConfig)
 	ips := make([]string, 0, len(tableView.Rows))
@@ -38,16 +38,36 @@ func TestRenderRemoteSummary(t *testing.T) {
 	ctx := context.Background()
 
 	var b bytes.Buffer
-	err := RenderRemoteSummary(ctx, &b, 2, 0, time.Millisecond*333)
+	err := RenderRemoteSummary(ctx, &b, RemoteCmdSummary{Successes: 2, Elapsed: time.Millisecond * 333})
 	assert.NoError(t, err, "RenderRemoteSummary should have returned no error")
 
 	assert.Equal(t, b.String(), "Finished: successes: 2, failures: 0, elapsed (secs): 0.33\n")
 
 	b.Reset()
-	err = RenderRemoteSummary(ctx, &b, 0, 3, time.Millisecond*777)
+	err = RenderRemoteSummary(ctx, &b, RemoteCmdSummary{Failures: 3, Elapsed: time.Millisecond * 777})
 	assert.NoError(t, err, "RenderRemoteSummary should have returned no error")
 
 	assert.Equal(t, b.String(), "Finished: successes: 0, failures: 3, elapsed (secs): 0.78\n")
+
+	b.Reset()
+	err = RenderRemoteSummary(ctx, &b, RemoteCmdSummary{Successes: 1, Failures: 2, Skipped: 7, Elapsed: time.Second})
+	assert.NoError(t, err, "RenderRemoteSummary should have returned no error")
+
+	assert.Equal(t, b.String(), "Finished: successes: 1, failures: 2, skipped: 7, elapsed (secs): 1.00\n")
+
+	b.Reset()
+	err = RenderRemoteSummary(ctx, &b, RemoteCmdSummary{Successes: 4, TimedOut: 2, Skipped: 1, Elapsed: time.Second})
+	assert.NoError(t, err, "RenderRemoteSummary should have returned no error")
+
+	assert.Equal(t, b.String(), "Finished: successes: 4, failures: 0, timed out: 2, skipped: 1, elapsed (secs): 1.00\n")
+
+	b.Reset()
+	err = RenderRemoteSummary(ctx, &b, RemoteCmdSummary{Successes: 1, Interrupted: 2, Skipped: 3,
+		InterruptedHosts: []string{"blade-0002", "blade-0003"}, Elapsed: time.Second})
+	assert.NoError(t, err, "RenderRemoteSummary should have returned no error")
+
+	assert.Equal(t, b.String(), "Finished: successes: 1, failures: 0, interrupted: 2, skipped: 3, elapsed (secs): 1.00\n"+
+		"Interrupted: blade-[0002-0003]\n")
 }
 
 func TestRenderIPs(t *testing.T) {
@@ -122,3 +142,53 @@ func TestRenderLogLine(t *testing.T) {
 	assert.Equal(t, b.String(),
 		"dinky >1 (0): restarting server...\ndinky >1 (1): file not found: foo.txt\ndinky >1 (2): hello world!\n")
 }
+
+func TestRenderDryRun(t *testing.T) {
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		t.Fatal("a dry run must never execute anything")
+		return -1, nil
+	}}
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 3
+	cfgCtx.DryRun = true
+	cfgCtx.CmdTimeout = time.Second * 30
+	cfgCtx.Template = true
+	cfgCtx.Rollout = RolloutStrategy{Canary: 1, Batch: BatchSize{Count: 2}}
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{{Original: "a"}, {Original: "b"}, {Original: "c", Alias: "cee"}}
+
+	var b bytes.Buffer
+	results := ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "restart {{.Machine}}")
+	assert.Empty(t, results, "nothing ran so there are no results")
+
+	assert.Equal(t, "Dry run: remote command: restart {{.Machine}}\n"+
+		"Hosts: 3, concurrency: 3, cmd timeout: 30s, deadline: none\n"+
+		"Rollout: canary of 1 host(s) halting on any failure, batches of 2\n"+
+		"Batch 1 of 2, 1 host(s) (canary)\n"+
+		"  a (0): fake a restart a\n"+
+		"Batch 2 of 2, 2 host(s)\n"+
+		"  b (1): fake b restart b\n"+
+		"  cee (2): fake c restart c\n"+
+		"Nothing was executed, this was a dry run.\n", b.String())
+
+	// Copies are planned the same way.
+	b.Reset()
+	results = ExecuteClusterCopy(ctx, &b, executor, hosts[:1], "./nginx.conf", "/etc/nginx")
+	assert.Empty(t, results)
+	assert.Contains(t, b.String(), "a (0): fake a mkdir -p '/etc/nginx' && tar -xf - -C '/etc/nginx' < tar of ./nginx.conf\n")
+
+	// With --json the plan is NDJSON, just like the real run would be.
+	b.Reset()
+	cfgCtx.JsonOutput = true
+	results = ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "restart {{.Machine}}")
+	assert.Empty(t, results)
+	assert.Equal(t, `{"type":"plan","batch":1,"canary":true,"idx":0,"host":"a","invocation":"fake a restart a"}`+"\n"+
+		`{"type":"plan","batch":2,"idx":1,"host":"b","invocation":"fake b restart b"}`+"\n"+
+		`{"type":"plan","batch":2,"idx":2,"host":"c","alias":"cee","invocation":"fake c restart c"}`+"\n"+
+		`{"type":"dry_run","desc":"remote command: restart {{.Machine}}","hosts":3,"batches":2,"concurrency":3,`+
+		`"cmd_timeout_secs":30,"deadline_secs":0,"rollout":"canary of 1 host(s) halting on any failure, batches of 2"}`+"\n",
+		b.String())
+}
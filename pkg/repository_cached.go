@@ -53,18 +53,20 @@ func (c *CachedRepository) DevicesResource(ctx context.Context) ([]*WrappedDevic
 
 	// Note: The DB is instantiated on demand for flexibility of using the DB generically on different types.
 	deviceIndexedRepo := NewDB2[*WrappedDevice](cfg.Tailnet)
-	existsAndRecent, err := deviceIndexedRepo.Exists(ctx)
-	if err != nil {
-		log.Warn("problem checking for bolt db file", "error", err)
+	if err := deviceIndexedRepo.Open(); err != nil {
+		return nil, err
 	}
+	defer deviceIndexedRepo.Close()
 
-	// 1. If the db cache file exists, and we're not asked to expunge the cache then return from the cache.
-	if existsAndRecent && !cfg.NoCache {
-
-		if err = deviceIndexedRepo.Open(); err != nil {
-			return nil, err
-		}
+	// The devices share the db file with other buckets, such as the jobs, so it's the devices bucket itself which
+	// must be recent rather than the file.
+	recent, err := deviceIndexedRepo.IsRecent(ctx, DevicesBucket)
+	if err != nil {
+		log.Warn("problem checking for recent devices in the bolt db file", "error", err)
+	}
 
+	// 1. If the devices were cached recently, and we're not asked to expunge the cache then return from the cache.
+	if recent && !cfg.NoCache {
 		// Care is taken to measure just cache retrieval time.
 		cachedStartTime := time.Now()
 		devList, err := deviceIndexedRepo.SearchOpaqueItems(ctx, DevicesBucket, DBQuery{PrefixFilters: cfg.PrefixFilter})
@@ -73,22 +75,16 @@ func (c *CachedRepository) DevicesResource(ctx context.Context) ([]*WrappedDevic
 		}
 
 		log.Debug("local db file (db.bolt) was found and recent enough so using this as a cache")
-		deviceIndexedRepo.Close()
 		cfg.CachedElapsed = time.Since(cachedStartTime)
 
 		return devList, nil
 	}
 
-	log.Debug("destroying and rebuilding local db cache file", "file", deviceIndexedRepo.File())
-	if err = deviceIndexedRepo.Erase(); err != nil {
+	// The db is locked for as long as it's open, so it's closed again while waiting on the remote lookup.
+	if err = deviceIndexedRepo.Close(); err != nil {
 		return nil, err
 	}
 
-	if err = deviceIndexedRepo.Open(); err != nil {
-		return nil, err
-	}
-	defer deviceIndexedRepo.Close()
-
 	// 2. Do remote lookup if we got here.
 	repoStartTime := time.Now()
 	devList, err := c.innerRepo.DevicesResource(ctx)
@@ -97,8 +93,13 @@ func (c *CachedRepository) DevicesResource(ctx context.Context) ([]*WrappedDevic
 	}
 	cfg.TailscaleAPI.ElapsedTime = time.Since(repoStartTime)
 
+	log.Debug("rebuilding the devices cached in the local db file", "file", deviceIndexedRepo.File())
+	if err = deviceIndexedRepo.Open(); err != nil {
+		return nil, err
+	}
+
 	// 3. Index the remotely found data.
-	err = deviceIndexedRepo.IndexOpaqueItems(ctx, DevicesBucket, devList)
+	err = deviceIndexedRepo.ReplaceOpaqueItems(ctx, DevicesBucket, devList)
 	if err != nil {
 		log.Debug("unable to index the devices", "error", err)
 	}
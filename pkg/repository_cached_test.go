@@ -114,4 +114,16 @@ func TestCachedRepository_DevicesResource(t *testing.T) {
 	assert.Equal(t, 1, remoteCalls)
 	//We did a single search, only 1 item should return.
 	assert.Equal(t, 1, len(devs))
+
+	// Refreshing the devices leaves the other buckets of the db file, such as the jobs, alone.
+	job := NewJob("remote command: uptime", "*", nil)
+	assert.NoError(t, NewJobStore(testTailnet).Save(ctx, job, nil))
+
+	cfg.NoCache = true
+	_, err = cachedRepo.DevicesResource(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, remoteCalls)
+
+	_, err = NewJobStore(testTailnet).Get(ctx, job.ID)
+	assert.NoError(t, err)
 }
@@ -0,0 +1,174 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BatchSize is either an absolute number of hosts or a percentage of the total hosts selected, only one is ever set.
+type BatchSize struct {
+	Count   int
+	Percent int
+}
+
+// ParseBatchSize parses a batch size such as: "5" (5 hosts at a time) or "10%" (10 percent of the hosts at a time).
+// An empty string yields the zero BatchSize which means: no batching.
+func ParseBatchSize(s string) (BatchSize, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return BatchSize{}, nil
+	}
+
+	if strings.HasSuffix(s, "%") {
+		pct, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(s, "%")))
+		if err != nil || pct <= 0 || pct > 100 {
+			return BatchSize{}, fmt.Errorf("batch percentage must be between 1%% and 100%%, got: %s", s)
+		}
+		return BatchSize{Percent: pct}, nil
+	}
+
+	count, err := strconv.Atoi(s)
+	if err != nil || count <= 0 {
+		return BatchSize{}, errors.New("batch must be a positive number of hosts or a percentage, got: " + s)
+	}
+	return BatchSize{Count: count}, nil
+}
+
+// IsDefined reports whether a batch size was requested at all.
+func (b BatchSize) IsDefined() bool {
+	return b.Count > 0 || b.Percent > 0
+}
+
+// Of resolves the batch size against the total number of hosts, it's always at least 1 host.
+func (b BatchSize) Of(total int) int {
+	var size int
+	switch {
+	case b.Count > 0:
+		size = b.Count
+	case b.Percent > 0:
+		// Round up, so 10% of 15 hosts is 2 hosts rather than 1.
+		size = (total*b.Percent + 99) / 100
+	default:
+		size = total
+	}
+
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+func (b BatchSize) String() string {
+	if b.Percent > 0 {
+		return fmt.Sprintf("%d%%", b.Percent)
+	}
+	return strconv.Itoa(b.Count)
+}
+
+// RolloutStrategy controls how a remote command is rolled out across the selected hosts. The zero value runs every
+// host at once, limited only by the concurrency setting.
+type RolloutStrategy struct {
+	// Batch is how many hosts are started per batch.
+	Batch BatchSize
+	// Canary is how many hosts run first, by themselves, before anything else is started. Should any canary host
+	// fail the rollout is halted.
+	Canary int
+	// Pause is how long to wait in-between batches.
+	Pause time.Duration
+	// MaxFailures stops any new hosts from starting once this many hosts have failed, 0 means unlimited.
+	MaxFailures int
+}
+
+// IsRolling reports whether the hosts will be executed in more than one wave.
+func (r RolloutStrategy) IsRolling() bool {
+	return r.Batch.IsDefined() || r.Canary > 0
+}
+
+// Batches partitions the host indices [0, total) into sequential batches with the canary batch (if any) first.
+func (r RolloutStrategy) Batches(total int) [][]int {
+	var (
+		batches [][]int
+		next    int
+	)
+
+	var take = func(n int) {
+		if next+n > total {
+			n = total - next
+		}
+		batch := make([]int, 0, n)
+		for i := 0; i < n; i++ {
+			batch = append(batch, next+i)
+		}
+		batches = append(batches, batch)
+		next += n
+	}
+
+	if r.Canary > 0 && total > 0 {
+		take(r.Canary)
+	}
+
+	size := r.Batch.Of(total - next)
+	if r.Batch.Percent > 0 {
+		// Percentages are always relative to the full selection, not what's left after the canary.
+		size = r.Batch.Of(total)
+	}
+
+	for next < total {
+		take(size)
+	}
+
+	return batches
+}
+
+// String describes the rollout in plain words, such as: canary of 1 host, then batches of 10%, pausing 30s in-between.
+func (r RolloutStrategy) String() string {
+	var parts []string
+	if r.Canary > 0 {
+		parts = append(parts, fmt.Sprintf("canary of %d host(s) halting on any failure", r.Canary))
+	}
+
+	switch {
+	case r.Batch.IsDefined():
+		parts = append(parts, "batches of "+r.Batch.String())
+	case r.Canary > 0:
+		parts = append(parts, "then all remaining hosts")
+	default:
+		parts = append(parts, "all hosts at once")
+	}
+
+	if r.Pause > 0 && r.IsRolling() {
+		parts = append(parts, fmt.Sprintf("pausing %s in-between", r.Pause))
+	}
+	if r.MaxFailures > 0 {
+		parts = append(parts, fmt.Sprintf("halting after %d failure(s)", r.MaxFailures))
+	}
+	return strings.Join(parts, ", ")
+}
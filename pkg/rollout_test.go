@@ -0,0 +1,94 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBatchSize(t *testing.T) {
+	b, err := ParseBatchSize("")
+	assert.NoError(t, err)
+	assert.False(t, b.IsDefined())
+
+	b, err = ParseBatchSize("5")
+	assert.NoError(t, err)
+	assert.Equal(t, BatchSize{Count: 5}, b)
+	assert.Equal(t, "5", b.String())
+
+	b, err = ParseBatchSize(" 10% ")
+	assert.NoError(t, err)
+	assert.Equal(t, BatchSize{Percent: 10}, b)
+	assert.Equal(t, "10%", b.String())
+
+	for _, bad := range []string{"0", "-3", "abc", "0%", "101%", "%"} {
+		_, err = ParseBatchSize(bad)
+		assert.Error(t, err, "expected an error for batch: %s", bad)
+	}
+}
+
+func TestBatchSizeOf(t *testing.T) {
+	assert.Equal(t, 5, BatchSize{Count: 5}.Of(100))
+	assert.Equal(t, 10, BatchSize{Percent: 10}.Of(100))
+	// Percentages round up and are never less than a single host.
+	assert.Equal(t, 2, BatchSize{Percent: 10}.Of(15))
+	assert.Equal(t, 1, BatchSize{Percent: 1}.Of(3))
+	// Undefined means everything at once.
+	assert.Equal(t, 42, BatchSize{}.Of(42))
+}
+
+func TestRolloutStrategyBatches(t *testing.T) {
+	// The zero value is a single batch of everything.
+	assert.Equal(t, [][]int{{0, 1, 2}}, RolloutStrategy{}.Batches(3))
+	assert.False(t, RolloutStrategy{}.IsRolling())
+
+	r := RolloutStrategy{Batch: BatchSize{Count: 2}}
+	assert.True(t, r.IsRolling())
+	assert.Equal(t, [][]int{{0, 1}, {2, 3}, {4}}, r.Batches(5))
+
+	r = RolloutStrategy{Batch: BatchSize{Percent: 40}, Canary: 1}
+	assert.Equal(t, [][]int{{0}, {1, 2}, {3, 4}}, r.Batches(5))
+
+	// A canary alone runs first and then everything else.
+	r = RolloutStrategy{Canary: 2}
+	assert.Equal(t, [][]int{{0, 1}, {2, 3, 4}}, r.Batches(5))
+
+	// A canary larger than the selection is just the whole selection.
+	assert.Equal(t, [][]int{{0, 1}}, r.Batches(2))
+	assert.Empty(t, r.Batches(0))
+}
+
+func TestRolloutStrategyString(t *testing.T) {
+	assert.Equal(t, "all hosts at once", RolloutStrategy{}.String())
+	assert.Equal(t, "all hosts at once, halting after 2 failure(s)", RolloutStrategy{MaxFailures: 2}.String())
+	assert.Equal(t, "batches of 10%, pausing 30s in-between, halting after 3 failure(s)",
+		RolloutStrategy{Batch: BatchSize{Percent: 10}, Pause: time.Second * 30, MaxFailures: 3}.String())
+	assert.Equal(t, "canary of 2 host(s) halting on any failure, then all remaining hosts",
+		RolloutStrategy{Canary: 2}.String())
+}
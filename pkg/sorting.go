@@ -28,6 +28,7 @@ package pkg
 import (
 	"sort"
 	"strings"
+	"time"
 )
 
 type SortDirection int
@@ -84,9 +85,45 @@ func dynamicSortDevices(slice []*WrappedDevice, specs []SortSpec) {
 						return slice[i].User > slice[j].User
 					}
 				}
+			case "REACHABLE":
+				ri, rj := reachable(slice[i]), reachable(slice[j])
+				if ri != rj {
+					// Ascending lists the reachable devices first.
+					return ri == (spec.Direction == Ascending)
+				}
+			case "PATH":
+				di, dj := reachable(slice[i]) && slice[i].PingInfo.Direct, reachable(slice[j]) && slice[j].PingInfo.Direct
+				if di != dj {
+					// Ascending lists the devices reached directly first.
+					return di == (spec.Direction == Ascending)
+				}
+			case "LATENCY":
+				// Unreachable devices have no latency, they always go last.
+				li, lj := pingLatency(slice[i]), pingLatency(slice[j])
+				if li != lj {
+					if li < 0 || lj < 0 {
+						return lj < 0
+					}
+					if spec.Direction == Ascending {
+						return li < lj
+					}
+					return li > lj
+				}
 				// Add cases for other fields...
 			}
 		}
 		return false
 	})
 }
+
+func reachable(d *WrappedDevice) bool {
+	return d.PingInfo != nil && d.PingInfo.Reachable
+}
+
+// pingLatency is the latency of a device's ping, or -1 when it's not known.
+func pingLatency(d *WrappedDevice) time.Duration {
+	if !reachable(d) {
+		return -1
+	}
+	return d.PingInfo.Latency
+}
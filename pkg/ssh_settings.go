@@ -0,0 +1,135 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// controlPath is where multiplexed ssh connections are kept, %C is a hash of the connection details so that each
+	// host, port and user gets its own master connection.
+	controlPath = "~/.ssh/tips-%C"
+	// controlPersist is how long an idle master connection lingers, long enough to be reused by the next command.
+	controlPersist = "60s"
+)
+
+// SSHOptions are the settings used to reach a host over ssh, any zero value leaves it up to the ssh defaults.
+type SSHOptions struct {
+	User         string `mapstructure:"user"`
+	Port         int    `mapstructure:"port"`
+	IdentityFile string `mapstructure:"identity_file"`
+	// Options are passed as ssh -o options, such as: "StrictHostKeyChecking=accept-new".
+	Options []string `mapstructure:"options"`
+}
+
+// SSHSettings is the "ssh_settings" section of the config file, it tunes how the executors reach hosts.
+type SSHSettings struct {
+	// Binary is the ssh binary to use, when empty it's looked up on the PATH.
+	Binary string `mapstructure:"binary"`
+	// SSHOptions apply to every host.
+	SSHOptions `mapstructure:",squash"`
+	// ControlMaster reuses a single connection per host across invocations, which makes repeated commands against
+	// the same hosts a lot quicker.
+	ControlMaster bool `mapstructure:"control_master"`
+	// Tags overrides the options for hosts carrying the tag, the "tag:" prefix is optional.
+	Tags map[string]SSHOptions `mapstructure:"tags"`
+}
+
+// ForTags returns the options for a host carrying the given tags. Tag overrides are applied on top of the general
+// options in the order of the host's tags, a later tag wins a conflicting setting while ssh -o options accumulate.
+func (s SSHSettings) ForTags(tags []string) SSHOptions {
+	opts := s.SSHOptions
+	opts.Options = append([]string{}, s.Options...)
+
+	for _, tag := range tags {
+		override, ok := s.tagOverride(tag)
+		if !ok {
+			continue
+		}
+
+		if len(override.User) > 0 {
+			opts.User = override.User
+		}
+		if override.Port > 0 {
+			opts.Port = override.Port
+		}
+		if len(override.IdentityFile) > 0 {
+			opts.IdentityFile = override.IdentityFile
+		}
+		opts.Options = append(opts.Options, override.Options...)
+	}
+
+	return opts
+}
+
+func (s SSHSettings) tagOverride(tag string) (SSHOptions, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "tag:"))
+	for name, override := range s.Tags {
+		if strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "tag:")) == tag {
+			return override, true
+		}
+	}
+	return SSHOptions{}, false
+}
+
+// sshArgs returns the ssh binary arguments for the options, they go before the host.
+func (s SSHSettings) sshArgs(opts SSHOptions) []string {
+	var args []string
+	if len(opts.User) > 0 {
+		args = append(args, "-l", opts.User)
+	}
+	if opts.Port > 0 {
+		args = append(args, "-p", strconv.Itoa(opts.Port))
+	}
+	if len(opts.IdentityFile) > 0 {
+		args = append(args, "-i", opts.IdentityFile)
+	}
+	if s.ControlMaster {
+		args = append(args, "-o", "ControlMaster=auto", "-o", "ControlPath="+controlPath,
+			"-o", "ControlPersist="+controlPersist)
+	}
+	for _, opt := range opts.Options {
+		args = append(args, "-o", opt)
+	}
+	return args
+}
+
+// expandHome expands a leading ~ of p into the home directory of the current user.
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, strings.TrimPrefix(p, "~"))
+}
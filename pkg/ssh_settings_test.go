@@ -0,0 +1,70 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSHSettingsForTags(t *testing.T) {
+	settings := SSHSettings{
+		SSHOptions: SSHOptions{User: "ops", Port: 22, Options: []string{"ServerAliveInterval=15"}},
+		Tags: map[string]SSHOptions{
+			"tag:db":  {User: "postgres", Options: []string{"StrictHostKeyChecking=accept-new"}},
+			"bastion": {Port: 2222, IdentityFile: "~/.ssh/bastion"},
+		},
+	}
+
+	// Untagged hosts get the general options.
+	assert.Equal(t, settings.SSHOptions, settings.ForTags(nil))
+
+	// The tag: prefix is optional on either side and overrides stack up.
+	assert.Equal(t, SSHOptions{
+		User:         "postgres",
+		Port:         2222,
+		IdentityFile: "~/.ssh/bastion",
+		Options:      []string{"ServerAliveInterval=15", "StrictHostKeyChecking=accept-new"},
+	}, settings.ForTags([]string{"db", "tag:bastion", "tag:web"}))
+
+	// Applying overrides never touches the general options.
+	assert.Equal(t, []string{"ServerAliveInterval=15"}, settings.Options)
+}
+
+func TestNativeSSHConfigFor(t *testing.T) {
+	cfg := nativeSSHConfigFor(SSHSettings{
+		SSHOptions: SSHOptions{User: "ops", Port: 2200, IdentityFile: "/keys/ops"},
+		Tags:       map[string]SSHOptions{"db": {User: "postgres"}},
+	})
+	assert.Equal(t, "ops", cfg.User)
+	assert.Equal(t, 2200, cfg.Port)
+	assert.Equal(t, "/keys/ops", cfg.KeyFiles[0], "the configured identity is tried first")
+
+	n := &NativeSSHExecutor{cfg: cfg}
+	assert.Equal(t, "(native) ssh -p 2200 postgres@blade uptime",
+		n.Describe("blade", &ExecRequest{Cmd: "uptime", Tags: []string{"tag:db"}}))
+}
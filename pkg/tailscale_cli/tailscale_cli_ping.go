@@ -0,0 +1,113 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tailscale_cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// pongRegex matches the reply printed by `tailscale ping`, such as:
+// pong from blade (100.64.0.1) via 203.0.113.5:41641 in 23ms
+// pong from blade (100.64.0.1) via DERP(nyc) in 45ms
+var pongRegex = regexp.MustCompile(`pong from (\S+) \(([^)]+)\) via (\S+) in (\S+)`)
+
+// PingResult is the outcome of pinging a single peer over the tailnet.
+type PingResult struct {
+	Target    string        `json:"target"`
+	Reachable bool          `json:"reachable"`
+	Latency   time.Duration `json:"latency"`
+	// Direct is true when the peer was reached without a relay, at Endpoint.
+	Direct   bool   `json:"direct"`
+	Endpoint string `json:"endpoint,omitempty"`
+	// DERPRegion is the region of the relay when the peer is only reachable via DERP.
+	DERPRegion string `json:"derp_region,omitempty"`
+	Err        string `json:"error,omitempty"`
+}
+
+// Ping sends a single disco ping to the target, a Tailscale IP or MagicDNS name, and reports whether it replied, how
+// quickly and over which path. An unreachable peer is not an error, only failing to run the Tailscale cli is.
+func Ping(ctx context.Context, target string, timeout time.Duration) (*PingResult, error) {
+	confirmedPath, err := BinaryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	// A single ping, reporting whichever path it took rather than retrying until the path is direct.
+	args := []string{"ping", "--c", "1", "--until-direct=false"}
+	if timeout > 0 {
+		args = append(args, "--timeout", timeout.String())
+	}
+	args = append(args, target)
+
+	output, err := exec.CommandContext(ctx, confirmedPath, args...).CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, err
+		}
+	}
+
+	return parsePing(target, string(output)), nil
+}
+
+// parsePing parses the output of `tailscale ping`, anything other than a pong means the target is unreachable.
+func parsePing(target, output string) *PingResult {
+	res := &PingResult{Target: target}
+
+	m := pongRegex.FindStringSubmatch(output)
+	if m == nil {
+		res.Err = strings.TrimSpace(output)
+		if len(res.Err) == 0 {
+			res.Err = "no reply"
+		}
+		return res
+	}
+
+	latency, err := time.ParseDuration(m[4])
+	if err != nil {
+		res.Err = fmt.Sprintf("unexpected latency in reply: %q", m[4])
+		return res
+	}
+
+	res.Reachable = true
+	res.Latency = latency
+
+	via := m[3]
+	if region, ok := strings.CutPrefix(via, "DERP("); ok {
+		res.DERPRegion = strings.TrimSuffix(region, ")")
+	} else {
+		res.Direct = true
+		res.Endpoint = via
+	}
+
+	return res
+}
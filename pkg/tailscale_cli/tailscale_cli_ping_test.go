@@ -0,0 +1,56 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tailscale_cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePing(t *testing.T) {
+	res := parsePing("100.64.0.1", "pong from blade (100.64.0.1) via 203.0.113.5:41641 in 23ms\n")
+	assert.Equal(t, &PingResult{
+		Target:    "100.64.0.1",
+		Reachable: true,
+		Latency:   23 * time.Millisecond,
+		Direct:    true,
+		Endpoint:  "203.0.113.5:41641",
+	}, res)
+
+	res = parsePing("blade", "pong from blade (100.64.0.1) via DERP(nyc) in 45.5ms\n")
+	assert.True(t, res.Reachable)
+	assert.False(t, res.Direct)
+	assert.Equal(t, "nyc", res.DERPRegion)
+	assert.Equal(t, 45500*time.Microsecond, res.Latency)
+
+	res = parsePing("100.64.0.9", "ping \"100.64.0.9\" timed out\n")
+	assert.False(t, res.Reachable)
+	assert.Equal(t, `ping "100.64.0.9" timed out`, res.Err)
+
+	assert.Equal(t, "no reply", parsePing("blade", "").Err)
+}
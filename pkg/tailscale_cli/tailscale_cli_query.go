@@ -26,6 +26,7 @@ SOFTWARE.
 package tailscale_cli
 
 import (
+	"fmt"
 	"os/exec"
 	"runtime"
 	"strings"
@@ -41,12 +42,17 @@ var (
 	binarySearchPathCandidates = map[string][]string{
 		"linux": {
 			"/usr/bin/tailscale",
+			// Anywhere else on the PATH, such as /usr/local/bin.
+			"tailscale",
 		},
 		"darwin": {
 			// When install via Mac App Store.
 			"/Applications/Tailscale.app/Contents/MacOS/Tailscale",
 		},
 	}
+
+	// binaryPathOverride, when set, is used instead of the search path candidates.
+	binaryPathOverride string
 )
 
 type DeviceInfo struct {
@@ -58,8 +64,26 @@ type DeviceInfo struct {
 	Tags              []string `json:"tags"`
 }
 
+// SetBinaryPath overrides where the Tailscale cli is found, such as when it's installed in a non-standard location.
+// An empty path restores the search of the known install locations.
+func SetBinaryPath(binPath string) {
+	binaryPathOverride = binPath
+}
+
+// BinaryPath returns the path of the Tailscale cli installed on this machine.
+func BinaryPath() (string, error) {
+	if len(binaryPathOverride) > 0 {
+		confirmedPath, err := exec.LookPath(binaryPathOverride)
+		if err != nil {
+			return "", fmt.Errorf("the configured tailscale_binary is not usable: %w", err)
+		}
+		return confirmedPath, nil
+	}
+	return utils.SelectBinaryPath(runtime.GOOS, binarySearchPathCandidates)
+}
+
 func GetVersion() (string, error) {
-	confirmedPath, err := utils.SelectBinaryPath(runtime.GOOS, binarySearchPathCandidates)
+	confirmedPath, err := BinaryPath()
 	if err != nil {
 		return "", err
 	}
@@ -74,7 +98,7 @@ func GetVersion() (string, error) {
 }
 
 func GetDevicesState() (map[string]DeviceInfo, error) {
-	confirmedPath, err := utils.SelectBinaryPath(runtime.GOOS, binarySearchPathCandidates)
+	confirmedPath, err := BinaryPath()
 	if err != nil {
 		return nil, err
 	}
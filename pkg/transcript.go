@@ -0,0 +1,225 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/charmbracelet/log"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// TranscriptManifest is the name of the JSONL manifest written within the output directory.
+	TranscriptManifest = "run.jsonl"
+
+	transcriptTimeFormat = time.RFC3339Nano
+)
+
+// TranscriptLine is the manifest record of a single line of output.
+type TranscriptLine struct {
+	Type   string    `json:"type"`
+	Idx    int       `json:"idx"`
+	Host   string    `json:"host"`
+	Alias  string    `json:"alias,omitempty"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"ts"`
+	Text   string    `json:"text"`
+}
+
+// TranscriptStatus is the manifest record describing how a host fared, one is written for every host once the run is
+// over, including those which were skipped.
+type TranscriptStatus struct {
+	Type        string     `json:"type"`
+	Idx         int        `json:"idx"`
+	Host        string     `json:"host"`
+	Alias       string     `json:"alias,omitempty"`
+	Status      string     `json:"status"`
+	ExitCode    int        `json:"exit_code"`
+	StartTime   *time.Time `json:"start,omitempty"`
+	EndTime     *time.Time `json:"end,omitempty"`
+	ElapsedSecs float64    `json:"elapsed_secs"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// transcriptOutput records everything a run produces into an output directory: a log file per host along with the
+// run.jsonl manifest. Unlike the terminal rendering nothing is colorized or filtered, stderr is always included.
+type transcriptOutput struct {
+	dir      string
+	manifest *os.File
+	enc      *jsoniter.Encoder
+	logs     map[int]*os.File
+}
+
+// newTranscriptOutput opens the manifest within the output directory, which must already exist.
+func newTranscriptOutput(dir string) (*transcriptOutput, error) {
+	f, err := os.Create(filepath.Join(dir, TranscriptManifest))
+	if err != nil {
+		return nil, err
+	}
+
+	return &transcriptOutput{
+		dir:      dir,
+		manifest: f,
+		enc:      jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(f),
+		logs:     make(map[int]*os.File),
+	}, nil
+}
+
+// hostLog returns the log file of the host, creating it upon first use. A nil file means it couldn't be created.
+func (t *transcriptOutput) hostLog(idx int, host RemoteCmdHost) *os.File {
+	if f, ok := t.logs[idx]; ok {
+		return f
+	}
+
+	f, err := os.Create(filepath.Join(t.dir, hostDirName(host)+".log"))
+	if err != nil {
+		log.Error("error creating transcript log file", "host", host.Original, "error", err)
+	}
+	t.logs[idx] = f
+	return f
+}
+
+func (t *transcriptOutput) hostStarted(ctx context.Context, idx int) {}
+
+func (t *transcriptOutput) line(ctx context.Context, hl hostLine) {
+	stream := "stdout"
+	if hl.stderr {
+		stream = "stderr"
+	}
+
+	if f := t.hostLog(hl.idx, RemoteCmdHost{Original: hl.hostname, Alias: hl.alias}); f != nil {
+		if _, err := fmt.Fprintf(f, "%s %s: %s\n", hl.ts.Format(transcriptTimeFormat), stream, hl.line); err != nil {
+			log.Error("error writing transcript log file", "host", hl.hostname, "error", err)
+		}
+	}
+
+	t.write(newTranscriptLine(hl))
+}
+
+func (t *transcriptOutput) hostDone(ctx context.Context, res *RemoteCmdResult) {
+	if res.Status == StatusSkipped {
+		return
+	}
+
+	// Even a host without any output gets its (empty) log file.
+	if f := t.hostLog(res.Idx, res.Host); f != nil {
+		if err := f.Close(); err != nil {
+			log.Error("error closing transcript log file", "host", res.Host.Original, "error", err)
+		}
+	}
+	t.logs[res.Idx] = nil
+}
+
+func (t *transcriptOutput) finish(ctx context.Context, results RemoteCmdResults) {
+	for _, res := range results {
+		if res != nil {
+			t.write(newTranscriptStatus(res))
+		}
+	}
+
+	if err := t.manifest.Close(); err != nil {
+		log.Error("error closing transcript manifest", "error", err)
+	}
+}
+
+func (t *transcriptOutput) write(record any) {
+	if err := t.enc.Encode(record); err != nil {
+		log.Error("error writing transcript manifest", "error", err)
+	}
+}
+
+func newTranscriptLine(hl hostLine) *TranscriptLine {
+	stream := "stdout"
+	if hl.stderr {
+		stream = "stderr"
+	}
+
+	return &TranscriptLine{
+		Type:   "line",
+		Idx:    hl.idx,
+		Host:   hl.hostname,
+		Alias:  hl.alias,
+		Stream: stream,
+		Time:   hl.ts,
+		Text:   hl.line,
+	}
+}
+
+func newTranscriptStatus(res *RemoteCmdResult) *TranscriptStatus {
+	s := &TranscriptStatus{
+		Type:     "status",
+		Idx:      res.Idx,
+		Host:     res.Host.Original,
+		Alias:    res.Host.Alias,
+		Status:   res.Status.String(),
+		ExitCode: res.ExitCode,
+	}
+
+	// Skipped hosts never started, so they have no times to speak of.
+	if !res.StartTime.IsZero() {
+		start, end := res.StartTime, res.EndTime
+		s.StartTime, s.EndTime = &start, &end
+		s.ElapsedSecs = res.Elapsed().Seconds()
+	}
+
+	if res.Err != nil {
+		s.Error = res.Err.Error()
+	}
+
+	return s
+}
+
+// teeOutput hands everything off to each of its outputs in turn.
+type teeOutput []remoteOutput
+
+func (t teeOutput) hostStarted(ctx context.Context, idx int) {
+	for _, o := range t {
+		o.hostStarted(ctx, idx)
+	}
+}
+
+func (t teeOutput) line(ctx context.Context, hl hostLine) {
+	for _, o := range t {
+		o.line(ctx, hl)
+	}
+}
+
+func (t teeOutput) hostDone(ctx context.Context, res *RemoteCmdResult) {
+	for _, o := range t {
+		o.hostDone(ctx, res)
+	}
+}
+
+func (t teeOutput) finish(ctx context.Context, results RemoteCmdResults) {
+	for _, o := range t {
+		o.finish(ctx, results)
+	}
+}
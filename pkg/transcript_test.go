@@ -0,0 +1,136 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+
+The MIT License (MIT)
+Copyright Ralph Caraveo (deckarep@gmail.com)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteClusterRemoteCmdTranscript(t *testing.T) {
+	executor := &fakeExecutor{exec: func(ctx context.Context, host string, req *ExecRequest) (int, error) {
+		switch host {
+		case "broken":
+			_, _ = io.WriteString(req.Stderr, "no such file\n")
+			return 2, errors.New("exit status 2")
+		case "quiet":
+			return 0, nil
+		}
+		_, _ = io.WriteString(req.Stdout, "hello\nworld\n")
+		return 0, nil
+	}}
+
+	dir := t.TempDir()
+
+	ctx := context.Background()
+	cfgCtx := NewConfigCtx()
+	cfgCtx.Concurrency = 5
+	cfgCtx.OutputDir = dir
+	// Stderr is recorded in the transcript even though it isn't rendered.
+	cfgCtx.Stderr = false
+	ctx = context.WithValue(ctx, CtxKeyConfig, cfgCtx)
+
+	hosts := []RemoteCmdHost{{Original: "foo", Alias: "app/1"}, {Original: "broken"}, {Original: "quiet"}}
+
+	var b bytes.Buffer
+	results := ExecuteClusterRemoteCmd(ctx, &b, executor, hosts, "whatever")
+	assert.Equal(t, 2, results.Successes())
+	assert.Contains(t, b.String(), "app/1 >1 (0): hello", "the terminal output is still rendered")
+
+	logOf := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name+".log"))
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	fooLog := logOf("app_1")
+	assert.Regexp(t, `(?m)^\S+ stdout: hello\n\S+ stdout: world\n$`, fooLog)
+	assert.Regexp(t, `(?m)^\S+ stderr: no such file\n$`, logOf("broken"))
+	assert.Empty(t, logOf("quiet"), "a host without output still gets a log file")
+
+	f, err := os.Open(filepath.Join(dir, TranscriptManifest))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var (
+		lines    []TranscriptLine
+		statuses = make(map[string]TranscriptStatus)
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		json := jsoniter.ConfigCompatibleWithStandardLibrary
+		if strings.Contains(scanner.Text(), `"type":"status"`) {
+			var s TranscriptStatus
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &s))
+			statuses[s.Host] = s
+			continue
+		}
+
+		var l TranscriptLine
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &l))
+		assert.Equal(t, "line", l.Type)
+		assert.False(t, l.Time.IsZero(), "every line is timestamped")
+		lines = append(lines, l)
+	}
+
+	assert.Len(t, lines, 3)
+	assert.Len(t, statuses, 3)
+
+	assert.Equal(t, "succeeded", statuses["foo"].Status)
+	assert.Equal(t, "app/1", statuses["foo"].Alias)
+	assert.Equal(t, "failed", statuses["broken"].Status)
+	assert.Equal(t, 2, statuses["broken"].ExitCode)
+	assert.Equal(t, "exit status 2", statuses["broken"].Error)
+	assert.NotNil(t, statuses["quiet"].StartTime)
+
+	for _, l := range lines {
+		if l.Host == "broken" {
+			assert.Equal(t, "stderr", l.Stream)
+			assert.Equal(t, "no such file", l.Text)
+		} else {
+			assert.Equal(t, "stdout", l.Stream)
+			assert.Equal(t, "app/1", l.Alias)
+		}
+	}
+}
+
+func TestNewTranscriptStatusSkipped(t *testing.T) {
+	s := newTranscriptStatus(skippedResult(3, RemoteCmdHost{Original: "foo"}, nil))
+	assert.Equal(t, "skipped", s.Status)
+	assert.Equal(t, 3, s.Idx)
+	assert.Nil(t, s.StartTime, "skipped hosts never started")
+	assert.Nil(t, s.EndTime)
+}
@@ -26,25 +26,43 @@ SOFTWARE.
 package utils
 
 import (
-	"errors"
+	"fmt"
 	"os/exec"
-	"runtime"
-
-	"github.com/charmbracelet/log"
+	"strings"
 )
 
+// SelectBinaryPath returns the first of the candidate paths for the platform that exists, candidates are either full
+// paths or binary names looked up on the PATH. It's an error when the platform has no candidates or none exist.
 func SelectBinaryPath(platform string, candidates map[string][]string) (string, error) {
-	osSelected := runtime.GOOS
+	paths, exists := candidates[platform]
+	if !exists {
+		return "", fmt.Errorf("no binary search paths are known for os: %s, configure the binary path instead", platform)
+	}
 
-	if paths, exists := candidates[platform]; exists {
-		for _, p := range paths {
-			if confirmedPath, err := exec.LookPath(p); err == nil {
-				return confirmedPath, nil
-			}
+	for _, p := range paths {
+		if confirmedPath, err := exec.LookPath(p); err == nil {
+			return confirmedPath, nil
 		}
-		return "", errors.New("no binary exists for this os: " + osSelected)
 	}
+	return "", fmt.Errorf("no binary found for os: %s, tried: %s", platform, strings.Join(paths, ", "))
+}
+
+// ShellQuote quotes s as a single argument for a posix shell, such that it's never subject to expansion.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
 
-	log.Fatal("binary is not setup for this os", "os", osSelected)
-	return "", nil
+// ShellQuoteIfNeeded is like ShellQuote but leaves s as is when it's already safe to use as a single argument, which
+// keeps command lines meant for display readable.
+func ShellQuoteIfNeeded(s string) string {
+	if len(s) == 0 {
+		return "''"
+	}
+	for _, r := range s {
+		isSafe := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:@%+=,", r)
+		if !isSafe {
+			return ShellQuote(s)
+		}
+	}
+	return s
 }
@@ -27,6 +27,7 @@ package utils
 
 import (
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -75,3 +76,55 @@ func TestSelectBinaryPath(t *testing.T) {
 	}
 
 }
+
+func TestSelectBinaryPathErrors(t *testing.T) {
+	c := map[string][]string{
+		"linux": {"nothingburger"},
+	}
+
+	_, err := SelectBinaryPath("plan9", c)
+	if err == nil || !strings.Contains(err.Error(), "plan9") {
+		t.Errorf("expected an error naming the unknown os, got: %v", err)
+	}
+
+	_, err = SelectBinaryPath("linux", c)
+	if err == nil || !strings.Contains(err.Error(), "nothingburger") {
+		t.Errorf("expected an error naming the tried paths, got: %v", err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"":             "''",
+		"/tmp/foo":     "'/tmp/foo'",
+		"with space":   "'with space'",
+		"it's":         `'it'\''s'`,
+		"$(rm -rf ~)":  "'$(rm -rf ~)'",
+		"a;b && c | d": "'a;b && c | d'",
+	}
+
+	for in, expected := range cases {
+		if actual := ShellQuote(in); actual != expected {
+			t.Errorf("expected ShellQuote(%q) to be: %s, got: %s", in, expected, actual)
+		}
+	}
+}
+
+func TestShellQuoteIfNeeded(t *testing.T) {
+	cases := map[string]string{
+		"":                    "''",
+		"/usr/bin/ssh":        "/usr/bin/ssh",
+		"user@blade-01:22":    "user@blade-01:22",
+		"-t":                  "-t",
+		"with space":          "'with space'",
+		"it's":                `'it'\''s'`,
+		"systemctl restart x": "'systemctl restart x'",
+		"$HOME":               "'$HOME'",
+	}
+
+	for in, expected := range cases {
+		if actual := ShellQuoteIfNeeded(in); actual != expected {
+			t.Errorf("expected ShellQuoteIfNeeded(%q) to be: %s, got: %s", in, expected, actual)
+		}
+	}
+}
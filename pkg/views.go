@@ -59,6 +59,8 @@ type GeneralTableView struct {
 	Self    *SelfView
 	Headers []Header
 	Rows    [][]string
+	// Devices backs each of the rows, in the same order.
+	Devices []*WrappedDevice `json:"-"`
 }
 
 func (g *GeneralTableView) HeaderTitles() []string {
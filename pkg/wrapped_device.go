@@ -29,6 +29,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/dustin/go-humanize"
 
@@ -43,6 +44,10 @@ import (
 type WrappedDevice struct {
 	tailscale.Device
 	EnrichedInfo *tailscale_cli.DeviceInfo `json:"enrichedInfo"`
+	// PingInfo is only present after the device was pinged with `tips ping`.
+	PingInfo *tailscale_cli.PingResult `json:"pingInfo,omitempty"`
+	// ProbeInfo is only present after the device's ports were probed with `tips probe`.
+	ProbeInfo map[int]PortState `json:"probeInfo,omitempty"`
 }
 
 // Key returns the device field of how this device gets indexed into the cached db.
@@ -58,6 +63,7 @@ func (w *WrappedDevice) Key() string {
 func (w *WrappedDevice) EvalColumnField(ctx context.Context, idx int, headerMatchName HeaderMatchName) string {
 	//cfg := CtxAsConfig(ctx, CtxKeyConfig)
 	enriched := w.EnrichedInfo != nil
+	pinged := w.PingInfo != nil
 
 	// Safely return an address at index.
 	var addrAtIndex = func(idx int) string {
@@ -91,6 +97,11 @@ func (w *WrappedDevice) EvalColumnField(ctx context.Context, idx int, headerMatc
 		return w.Hostname
 	case MatchNameIpv6:
 		return addrAtIndex(1)
+	case MatchNameLatency:
+		if !pinged || !w.PingInfo.Reachable {
+			return "n/a"
+		}
+		return w.PingInfo.Latency.Round(time.Microsecond * 100).String()
 	case MatchNameLastSeen:
 		return fmt.Sprintf("%s", w.LastSeen)
 	case MatchNameName, MatchNameMachine:
@@ -107,6 +118,23 @@ func (w *WrappedDevice) EvalColumnField(ctx context.Context, idx int, headerMatc
 			lastSeenAgo = nowField
 		}
 		return lastSeenAgo
+	case MatchNamePath:
+		switch {
+		case !pinged || !w.PingInfo.Reachable:
+			return "n/a"
+		case w.PingInfo.Direct:
+			return fmt.Sprintf("direct (%s)", w.PingInfo.Endpoint)
+		default:
+			return fmt.Sprintf("derp (%s)", w.PingInfo.DERPRegion)
+		}
+	case MatchNameReachable:
+		if !pinged {
+			return "n/a"
+		}
+		if w.PingInfo.Reachable {
+			return checkField
+		}
+		return "no"
 	case MatchNameTags:
 		// Remove all tag: prefixes, and join the tags as a comma delimited string.
 		tags := strings.Replace(strings.Join(w.Tags, ", "), "tag:", "", -1)
@@ -117,6 +145,9 @@ func (w *WrappedDevice) EvalColumnField(ctx context.Context, idx int, headerMatc
 		version := fmt.Sprintf("%s - %s", strings.Split(w.ClientVersion, "-")[0], w.OS)
 		return version
 	default:
+		if state, ok := w.portState(headerMatchName); ok {
+			return state
+		}
 		panic(`unknown MatchName column requested (a new MatchName filed was likely introduced but not 
 handled here): ` + headerMatchName)
 	}